@@ -0,0 +1,37 @@
+// Command mockidp runs a local OpenID provider for trying out university
+// single sign-on without a real identity provider:
+//
+//	go run ./cmd/mockidp
+//	OIDC_ISSUER=http://localhost:9000 OIDC_CLIENT_ID=forum go run ./cmd/server
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+
+	"github.com/stefvuck/forum/internal/oidc/mockidp"
+)
+
+func getEnv(key, fallback string) string {
+	if value, exists := os.LookupEnv(key); exists {
+		return value
+	}
+	return fallback
+}
+
+func main() {
+	issuer := getEnv("MOCK_IDP_ISSUER", "http://localhost:9000")
+	clientID := getEnv("MOCK_IDP_CLIENT_ID", "forum")
+	port := getEnv("MOCK_IDP_PORT", "9000")
+
+	server, err := mockidp.New(issuer, clientID)
+	if err != nil {
+		panic(err)
+	}
+
+	fmt.Printf("Mock identity provider running at %s (client_id %q)\n", issuer, clientID)
+	if err := http.ListenAndServe(":"+port, server.Handler()); err != nil {
+		panic(err)
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/stefvuck/forum/internal/mailer"
+)
+
+// Name shown on the threads and replies of deleted accounts
+const deletedUserName = "Deleted user"
+
+// Role deleted accounts are moved to, it can't do anything
+const anonymisedRoleName = "guest"
+
+// anonymiseUser removes everything identifying from an account but keeps the
+// row, so its threads and replies stay readable under deletedUserName
+func anonymiseUser(db *gorm.DB, userID uint) error {
+	return db.Transaction(func(tx *gorm.DB) error {
+		// The row stays for their posts, it mustn't keep the powers of their role
+		var guest Role
+		if err := tx.Where("name = ?", anonymisedRoleName).First(&guest).Error; err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if err := tx.Model(&User{}).Where("id = ?", userID).Updates(map[string]interface{}{
+			"role_id":               guest.ID,
+			"email":                 "",
+			"name":                  deletedUserName,
+			"password":              "",
+			"verified":              false,
+			"verify_token":          "",
+			"reset_token":           "",
+			"totp_secret":           "",
+			"totp_enabled":          false,
+			"oidc_subject":          "",
+			"allowed_sections":      "",
+			"bio":                   "",
+			"profile_picture_url":   "",
+			"deletion_scheduled_at": nil,
+			"anonymised_at":         now,
+		}).Error; err != nil {
+			return err
+		}
+
+		// Sessions and security events hold IP addresses and user agents
+		for _, model := range []interface{}{
+			&Session{},
+			&AccessToken{},
+			&RecoveryCode{},
+			&UserEmail{},
+			&EmailChange{},
+			&SecurityEvent{},
+		} {
+			if err := tx.Unscoped().Where("user_id = ?", userID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		// Their section rules are kept but grant nothing. Deleting them could
+		// leave a section with no rules at all, which opens it to everyone.
+		return tx.Model(&SectionRule{}).Where("user_id = ?", userID).
+			Updates(map[string]interface{}{"can_read": false, "can_post": false, "can_moderate": false}).Error
+	})
+}
+
+// anonymiseDueAccounts anonymises accounts whose deletion grace period has passed
+func anonymiseDueAccounts(db *gorm.DB) (int, error) {
+	var ids []uint
+	if err := db.Model(&User{}).
+		Where("deletion_scheduled_at IS NOT NULL AND deletion_scheduled_at <= ?", time.Now()).
+		Pluck("id", &ids).Error; err != nil {
+		return 0, err
+	}
+
+	for i, id := range ids {
+		if err := anonymiseUser(db, id); err != nil {
+			return i, err
+		}
+	}
+	return len(ids), nil
+}
+
+func startAccountDeletion(db *gorm.DB) {
+	startBackgroundJob("account deletion", time.Hour, func() error {
+		deleted, err := anonymiseDueAccounts(db)
+		if deleted > 0 {
+			fmt.Printf("Anonymised %d deleted accounts\n", deleted)
+		}
+		return err
+	})
+}
+
+func requestAccountDeletion(db *gorm.DB, config Config, mail mailer.Mailer, guard *LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Password string `json:"password"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		var user User
+		if err := db.First(&user, getUserIdFromToken(c)).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		// Accounts created through single sign-on have no password
+		if user.Password != "" && !checkCurrentPassword(c, db, guard, mail, &user, input.Password) {
+			return
+		}
+
+		if user.DeletionScheduledAt != nil {
+			c.JSON(http.StatusBadRequest, gin.H{
+				"error":                 "Account deletion is already scheduled",
+				"deletion_scheduled_at": user.DeletionScheduledAt,
+			})
+			return
+		}
+
+		scheduledAt := time.Now().Add(time.Duration(config.AccountDeletionGraceDays) * 24 * time.Hour)
+		if err := db.Model(&user).Update("deletion_scheduled_at", scheduledAt).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to schedule account deletion"})
+			return
+		}
+
+		// No grace period, delete straight away
+		if config.AccountDeletionGraceDays <= 0 {
+			if err := anonymiseUser(db, user.ID); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete account"})
+				return
+			}
+			clearAuthCookies(c)
+			c.JSON(http.StatusOK, gin.H{"message": "Your account has been deleted"})
+			return
+		}
+
+		go func(user User) {
+			if err := mailer.SendTemplate(mail, "account_deletion_scheduled", user.Email, gin.H{
+				"Name": user.Name,
+				"When": scheduledAt.Format("2 Jan 2006 at 15:04 MST"),
+			}); err != nil {
+				fmt.Println("Error sending account deletion email:", err)
+			}
+		}(user)
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":               "Your account will be deleted unless you cancel before then",
+			"deletion_scheduled_at": scheduledAt,
+		})
+	}
+}
+
+func cancelAccountDeletion(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		result := db.Model(&User{}).
+			Where("id = ? AND deletion_scheduled_at IS NOT NULL", getUserIdFromToken(c)).
+			Update("deletion_scheduled_at", nil)
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel account deletion"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Account deletion is not scheduled"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Account deletion cancelled"})
+	}
+}
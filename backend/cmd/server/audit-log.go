@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Audit log actions, named <target>.<verb>
+const (
+	AuditUserRoleChanged      = "user.role_changed"
+	AuditUserLockoutCleared   = "user.lockout_cleared"
+	AuditUserSuspended        = "user.suspended"
+	AuditSuspensionLifted     = "user.suspension_lifted"
+	AuditRoleCreated          = "role.created"
+	AuditRoleUpdated          = "role.updated"
+	AuditRoleDeleted          = "role.deleted"
+	AuditSectionRuleSet       = "section_rule.set"
+	AuditSectionRuleDeleted   = "section_rule.deleted"
+	AuditEmailDomainSet       = "email_domain.set"
+	AuditEmailDomainDeleted   = "email_domain.deleted"
+	AuditRegistrationApproved = "registration.approved"
+	AuditRegistrationRejected = "registration.rejected"
+	AuditInviteCreated        = "invite.created"
+	AuditInviteRevoked        = "invite.revoked"
+	AuditThreadDeleted        = "thread.deleted"
+	AuditReplyDeleted         = "reply.deleted"
+)
+
+// Audit log target types
+const (
+	AuditTargetUser        = "user"
+	AuditTargetRole        = "role"
+	AuditTargetSectionRule = "section_rule"
+	AuditTargetEmailDomain = "email_domain"
+	AuditTargetInvite      = "invite"
+	AuditTargetThread      = "thread"
+	AuditTargetReply       = "reply"
+)
+
+var auditActions = map[string]bool{
+	AuditUserRoleChanged:      true,
+	AuditUserLockoutCleared:   true,
+	AuditUserSuspended:        true,
+	AuditSuspensionLifted:     true,
+	AuditRoleCreated:          true,
+	AuditRoleUpdated:          true,
+	AuditRoleDeleted:          true,
+	AuditSectionRuleSet:       true,
+	AuditSectionRuleDeleted:   true,
+	AuditEmailDomainSet:       true,
+	AuditEmailDomainDeleted:   true,
+	AuditRegistrationApproved: true,
+	AuditRegistrationRejected: true,
+	AuditInviteCreated:        true,
+	AuditInviteRevoked:        true,
+	AuditThreadDeleted:        true,
+	AuditReplyDeleted:         true,
+}
+
+// auditJSON marshals a before or after value, nil stays SQL NULL
+func auditJSON(value interface{}) json.RawMessage {
+	if value == nil {
+		return nil
+	}
+	data, err := json.Marshal(value)
+	if err != nil {
+		fmt.Println("Error encoding audit log value:", err)
+		return nil
+	}
+	return data
+}
+
+// auditSuspension is what the audit log keeps of a suspension. Entries about
+// users hold only IDs and role IDs, never their email or name, and the
+// reason is free text that may well contain either, so it stays in the
+// suspensions table where it's removed with the account.
+func auditSuspension(suspension *Suspension) gin.H {
+	return gin.H{
+		"suspension_id": suspension.ID,
+		"scope":         suspension.Scope,
+		"expires_at":    suspension.ExpiresAt,
+		"created_by_id": suspension.CreatedByID,
+		"lifted_by_id":  suspension.LiftedByID,
+	}
+}
+
+// Actor of changes the server makes by itself rather than for a user
+const auditSystemActor uint = 0
+
+// recordAudit logs an action by the caller with the request's IP and user
+// agent. Like recordSecurityEvent, failing to log never fails the request.
+func recordAudit(db *gorm.DB, c *gin.Context, action, targetType string, targetID uint, before, after interface{}) {
+	writeAudit(db, c, getUserIdFromToken(c), action, targetType, targetID, before, after)
+}
+
+// recordSystemAudit logs a change the server made as a side effect of the
+// request, such as a role change following an email removal, under
+// auditSystemActor rather than the caller
+func recordSystemAudit(db *gorm.DB, c *gin.Context, action, targetType string, targetID uint, before, after interface{}) {
+	writeAudit(db, c, auditSystemActor, action, targetType, targetID, before, after)
+}
+
+func writeAudit(db *gorm.DB, c *gin.Context, actorID uint, action, targetType string, targetID uint, before, after interface{}) {
+	entry := AuditLog{
+		ActorID:    actorID,
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		Before:     auditJSON(before),
+		After:      auditJSON(after),
+		IP:         c.ClientIP(),
+		UserAgent:  c.Request.UserAgent(),
+	}
+	if err := db.Create(&entry).Error; err != nil {
+		fmt.Println("Error recording audit log entry:", err)
+	}
+}
+
+// protectAuditLog makes the audit log append only at the database level, so
+// not even a bug or a stray query can rewrite history
+func protectAuditLog(db *gorm.DB) error {
+	return db.Exec(`
+        CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+        BEGIN
+            RAISE EXCEPTION 'audit_log is append only';
+        END;
+        $$ LANGUAGE plpgsql;
+
+        DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+        CREATE TRIGGER audit_log_append_only
+            BEFORE UPDATE OR DELETE OR TRUNCATE ON audit_log
+            FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+    `).Error
+}
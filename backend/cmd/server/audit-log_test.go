@@ -0,0 +1,21 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAuditSuspensionLeavesOutReason(t *testing.T) {
+	suspension := &Suspension{UserID: 7, Scope: SuspensionReadOnly, Reason: "Reported by jane.smith@student.gla.ac.uk", CreatedByID: 2}
+	suspension.ID = 3
+
+	data := string(auditJSON(auditSuspension(suspension)))
+	if strings.Contains(data, "jane") || strings.Contains(data, "Reported") {
+		t.Errorf("audit entry %s contains the reason", data)
+	}
+	for _, want := range []string{`"suspension_id":3`, `"created_by_id":2`, `"scope":"` + SuspensionReadOnly + `"`} {
+		if !strings.Contains(data, want) {
+			t.Errorf("audit entry %s missing %s", data, want)
+		}
+	}
+}
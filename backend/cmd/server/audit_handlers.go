@@ -0,0 +1,157 @@
+package main
+
+import (
+	"encoding/csv"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// auditLogQuery applies the filters shared by the list and the export:
+// actor_id, action, target_type, target_id and since/until as RFC 3339 times
+func auditLogQuery(c *gin.Context, db *gorm.DB) (*gorm.DB, bool) {
+	query := db.Model(&AuditLog{})
+
+	for _, filter := range []struct{ param, column string }{
+		{"actor_id", "actor_id"},
+		{"target_id", "target_id"},
+	} {
+		if value := c.Query(filter.param); value != "" {
+			id, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + filter.param})
+				return nil, false
+			}
+			query = query.Where(filter.column+" = ?", id)
+		}
+	}
+
+	if action := c.Query("action"); action != "" {
+		if !auditActions[action] {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown action: " + action})
+			return nil, false
+		}
+		query = query.Where("action = ?", action)
+	}
+	if targetType := c.Query("target_type"); targetType != "" {
+		query = query.Where("target_type = ?", targetType)
+	}
+
+	for _, filter := range []struct{ param, condition string }{
+		{"since", "created_at >= ?"},
+		{"until", "created_at < ?"},
+	} {
+		if value := c.Query(filter.param); value != "" {
+			t, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid " + filter.param + ", use RFC 3339 like 2025-01-31T00:00:00Z"})
+				return nil, false
+			}
+			query = query.Where(filter.condition, t)
+		}
+	}
+
+	return query, true
+}
+
+func getAuditLog(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, ok := auditLogQuery(c, db)
+		if !ok {
+			return
+		}
+
+		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "50"))
+		if page < 1 {
+			page = 1
+		}
+		if pageSize < 1 || pageSize > 200 {
+			pageSize = 50
+		}
+
+		var total int64
+		if err := query.Session(&gorm.Session{}).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count audit log entries"})
+			return
+		}
+
+		var entries []AuditLog
+		if err := query.Session(&gorm.Session{}).
+			Order("created_at DESC, id DESC").
+			Offset((page - 1) * pageSize).
+			Limit(pageSize).
+			Find(&entries).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"entries": entries,
+			"pagination": gin.H{
+				"page":      page,
+				"page_size": pageSize,
+				"total":     total,
+			},
+		})
+	}
+}
+
+// csvSafe stops spreadsheets treating a value someone else controls, like a
+// user agent, as a formula
+func csvSafe(value string) string {
+	if value != "" && strings.ContainsRune("=+-@\t\r", rune(value[0])) {
+		return "'" + value
+	}
+	return value
+}
+
+// exportAuditLog streams every matching entry as CSV, oldest first
+func exportAuditLog(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query, ok := auditLogQuery(c, db)
+		if !ok {
+			return
+		}
+
+		rows, err := query.Order("created_at, id").Rows()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to export audit log"})
+			return
+		}
+		defer rows.Close()
+
+		filename := "audit-log-" + time.Now().UTC().Format("20060102-150405") + ".csv"
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+		c.Status(http.StatusOK)
+
+		w := csv.NewWriter(c.Writer)
+		w.Write([]string{"id", "created_at", "actor_id", "action", "target_type", "target_id", "before", "after", "ip", "user_agent"})
+
+		for rows.Next() {
+			var entry AuditLog
+			if err := db.ScanRows(rows, &entry); err != nil {
+				// Headers are already sent, all we can do is stop
+				break
+			}
+			w.Write([]string{
+				strconv.FormatUint(uint64(entry.ID), 10),
+				entry.CreatedAt.UTC().Format(time.RFC3339),
+				strconv.FormatUint(uint64(entry.ActorID), 10),
+				entry.Action,
+				entry.TargetType,
+				strconv.FormatUint(uint64(entry.TargetID), 10),
+				csvSafe(string(entry.Before)),
+				csvSafe(string(entry.After)),
+				csvSafe(entry.IP),
+				csvSafe(entry.UserAgent),
+			})
+		}
+		w.Flush()
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/stefvuck/forum/internal/auth"
+)
+
+// Cookie mode keeps tokens out of reach of page scripts: the access and
+// refresh tokens are set as HttpOnly cookies instead of returned in the body.
+// Browsers attach cookies to cross-site requests too, so requests
+// authenticated by cookie must repeat the CSRF cookie's value in a header
+// (double submit), which another site can't read. The Authorization header
+// works in either mode.
+const (
+	accessCookieName  = "gud_access"
+	refreshCookieName = "gud_refresh"
+	csrfCookieName    = "gud_csrf"
+	csrfHeaderName    = "X-CSRF-Token"
+)
+
+type CookieSettings struct {
+	Enabled  bool
+	Domain   string
+	Secure   bool
+	SameSite http.SameSite
+}
+
+func newCookieSettings(config Config) *CookieSettings {
+	sameSite := http.SameSiteLaxMode
+	switch strings.ToLower(config.CookieSameSite) {
+	case "strict":
+		sameSite = http.SameSiteStrictMode
+	case "none":
+		sameSite = http.SameSiteNoneMode
+	}
+
+	return &CookieSettings{
+		Enabled:  config.AuthCookies,
+		Domain:   config.CookieDomain,
+		Secure:   config.CookieSecure,
+		SameSite: sameSite,
+	}
+}
+
+// UseCookieSettings makes the cookie settings available to the handlers
+// that issue and clear tokens
+func UseCookieSettings(settings *CookieSettings) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.Set("cookieSettings", settings)
+		c.Next()
+	}
+}
+
+func cookieSettings(c *gin.Context) *CookieSettings {
+	if settings, exists := c.Get("cookieSettings"); exists {
+		return settings.(*CookieSettings)
+	}
+	return &CookieSettings{}
+}
+
+func (s *CookieSettings) set(c *gin.Context, name, value, path string, maxAge time.Duration, httpOnly bool) {
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     path,
+		Domain:   s.Domain,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   s.Secure,
+		HttpOnly: httpOnly,
+		SameSite: s.SameSite,
+	})
+}
+
+// writeAuthCookies moves the tokens in a login or refresh response into
+// cookies when cookie mode is on, replacing them with a new CSRF token
+func writeAuthCookies(c *gin.Context, response gin.H) error {
+	settings := cookieSettings(c)
+	if !settings.Enabled {
+		return nil
+	}
+
+	csrfToken, err := auth.GenerateRandomToken()
+	if err != nil {
+		return err
+	}
+
+	settings.set(c, accessCookieName, response["token"].(string), "/api", auth.AccessTokenLifetime, true)
+	settings.set(c, refreshCookieName, response["refresh_token"].(string), "/api/auth", refreshTokenLifetime, true)
+	settings.set(c, csrfCookieName, csrfToken, "/", refreshTokenLifetime, false)
+
+	delete(response, "token")
+	delete(response, "refresh_token")
+	response["csrf_token"] = csrfToken
+	return nil
+}
+
+func clearAuthCookies(c *gin.Context) {
+	settings := cookieSettings(c)
+	if !settings.Enabled {
+		return
+	}
+	settings.set(c, accessCookieName, "", "/api", -time.Second, true)
+	settings.set(c, refreshCookieName, "", "/api/auth", -time.Second, true)
+	settings.set(c, csrfCookieName, "", "/", -time.Second, false)
+}
+
+// validCSRF checks the double submit token on a request authenticated by
+// cookie. Safe methods don't change anything so don't need one.
+func validCSRF(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return true
+	}
+
+	cookie, err := c.Cookie(csrfCookieName)
+	if err != nil || cookie == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(c.GetHeader(csrfHeaderName))) == 1
+}
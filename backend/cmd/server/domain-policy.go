@@ -0,0 +1,174 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"gorm.io/gorm"
+)
+
+// Approval states for User.ApprovalStatus
+const (
+	ApprovalApproved = "approved"
+	ApprovalPending  = "pending"
+)
+
+// What happens to registrations from domains not on the allow-list
+const (
+	UnknownDomainReject   = "reject"
+	UnknownDomainApproval = "approval"
+)
+
+var ErrDomainNotAllowed = errors.New("email domain not allowed")
+
+// RegistrationDecision is the outcome of checking an email against the policy
+type RegistrationDecision struct {
+	Role   Role
+	Status string
+}
+
+type DomainPolicy struct {
+	db            *gorm.DB
+	unknownPolicy string
+	pendingRole   string
+}
+
+func NewDomainPolicy(db *gorm.DB, config Config) *DomainPolicy {
+	return &DomainPolicy{
+		db:            db,
+		unknownPolicy: config.UnknownDomainPolicy,
+		pendingRole:   config.PendingRegistrationRole,
+	}
+}
+
+// emailDomain returns the lowercased domain part of an email address
+func emailDomain(email string) string {
+	at := strings.LastIndex(email, "@")
+	if at < 0 {
+		return ""
+	}
+	return normalizeDomain(email[at+1:])
+}
+
+// normalizeDomain puts a configured or entered domain in the form
+// emailDomain produces, so "@Student.GLA.ac.uk " matches student addresses
+func normalizeDomain(domain string) string {
+	return strings.ToLower(strings.TrimPrefix(strings.TrimSpace(domain), "@"))
+}
+
+// Evaluate decides which role a new account gets and whether it needs
+// approval. Returns ErrDomainNotAllowed if it should be rejected.
+func (p *DomainPolicy) Evaluate(email string) (*RegistrationDecision, error) {
+	var domain EmailDomain
+	err := p.db.Preload("Role").Where("domain = ?", emailDomain(email)).First(&domain).Error
+	if err == nil {
+		return &RegistrationDecision{Role: domain.Role, Status: ApprovalApproved}, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, err
+	}
+
+	if p.unknownPolicy != UnknownDomainApproval {
+		return nil, ErrDomainNotAllowed
+	}
+
+	var role Role
+	if err := p.db.Where("name = ?", p.pendingRole).First(&role).Error; err != nil {
+		return nil, fmt.Errorf("pending registration role %q: %w", p.pendingRole, err)
+	}
+	return &RegistrationDecision{Role: role, Status: ApprovalPending}, nil
+}
+
+// seedEmailDomains adds the domains from config that aren't in the database
+// yet. Domains edited through the admin API are left alone.
+func seedEmailDomains(db *gorm.DB, domains map[string]string) error {
+	for name, roleName := range domains {
+		name = normalizeDomain(name)
+		roleName = strings.TrimSpace(roleName)
+
+		var count int64
+		if err := db.Model(&EmailDomain{}).Where("domain = ?", name).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		var role Role
+		if err := db.Where("name = ?", roleName).First(&role).Error; err != nil {
+			fmt.Printf("Skipping email domain %s: role %q not found\n", name, roleName)
+			continue
+		}
+
+		if err := db.Create(&EmailDomain{Domain: name, RoleID: role.ID}).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// seedAlumniRoles sets the alumni role on domains from config that don't
+// have one yet
+func seedAlumniRoles(db *gorm.DB, domains map[string]string) error {
+	for name, roleName := range domains {
+		name = normalizeDomain(name)
+		roleName = strings.TrimSpace(roleName)
+
+		var role Role
+		if err := db.Where("name = ?", roleName).First(&role).Error; err != nil {
+			fmt.Printf("Skipping alumni role for %s: role %q not found\n", name, roleName)
+			continue
+		}
+
+		if err := db.Model(&EmailDomain{}).
+			Where("domain = ? AND alumni_role_id IS NULL", name).
+			Update("alumni_role_id", role.ID).Error; err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AlumniTransition moves the user to the alumni role of removedEmail's domain
+// if that domain gave them their current role and none of their remaining
+// addresses would. Users given another role by an admin are left alone.
+// Returns whether the role changed.
+func (p *DomainPolicy) AlumniTransition(user *User, removedEmail string) (bool, error) {
+	var domain EmailDomain
+	err := p.db.Where("domain = ?", emailDomain(removedEmail)).First(&domain).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+	if domain.AlumniRoleID == nil || domain.RoleID != user.RoleID {
+		return false, nil
+	}
+
+	remaining := []string{emailDomain(user.Email)}
+	var emails []UserEmail
+	if err := p.db.Where("user_id = ? AND verified = ?", user.ID, true).Find(&emails).Error; err != nil {
+		return false, err
+	}
+	for _, email := range emails {
+		remaining = append(remaining, emailDomain(email.Email))
+	}
+
+	var count int64
+	if err := p.db.Model(&EmailDomain{}).
+		Where("domain IN ? AND role_id = ?", remaining, user.RoleID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return false, nil
+	}
+
+	if err := p.db.Model(user).Update("role_id", *domain.AlumniRoleID).Error; err != nil {
+		return false, err
+	}
+	user.RoleID = *domain.AlumniRoleID
+	return true, nil
+}
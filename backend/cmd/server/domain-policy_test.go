@@ -0,0 +1,19 @@
+package main
+
+import "testing"
+
+func TestConfiguredDomainsMatchEmails(t *testing.T) {
+	tests := []struct {
+		configured, email string
+	}{
+		{"student.gla.ac.uk", "jane@student.gla.ac.uk"},
+		{"Student.GLA.ac.uk", "jane@student.gla.ac.uk"},
+		{" student.gla.ac.uk ", "Jane@STUDENT.gla.ac.uk"},
+		{"@glasgow.ac.uk", "staff@Glasgow.ac.uk"},
+	}
+	for _, tt := range tests {
+		if normalizeDomain(tt.configured) != emailDomain(tt.email) {
+			t.Errorf("%q = %q, doesn't match %q from %s", tt.configured, normalizeDomain(tt.configured), emailDomain(tt.email), tt.email)
+		}
+	}
+}
@@ -0,0 +1,255 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/stefvuck/forum/internal/auth"
+	"github.com/stefvuck/forum/internal/mailer"
+)
+
+const emailChangeLifetime = 24 * time.Hour
+
+var errEmailChangeGone = errors.New("email change is no longer pending")
+
+func emailChangeLink(config Config, action, token string) string {
+	return config.APIUrl + "/api/auth/email-change/" + action + "?token=" + url.QueryEscape(token)
+}
+
+// checkNewEmail applies the registration rules to an address a user wants to
+// move to, responding and returning false if it can't be used
+func checkNewEmail(c *gin.Context, db *gorm.DB, policy *DomainPolicy, user User, email string) bool {
+	taken, err := emailTaken(db, email, user.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email"})
+		return false
+	}
+	if taken {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Email is already in use"})
+		return false
+	}
+
+	decision, err := policy.Evaluate(email)
+	if err != nil {
+		if errors.Is(err, ErrDomainNotAllowed) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "This email domain is not allowed"})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check email domain"})
+		return false
+	}
+	// The approval queue is for new accounts, existing ones can't use it
+	if decision.Status != ApprovalApproved {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "This email domain is not allowed"})
+		return false
+	}
+	return true
+}
+
+func requestEmailChange(db *gorm.DB, config Config, mail mailer.Mailer, guard *LoginGuard, policy *DomainPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			NewEmail string `json:"new_email" binding:"required,email"`
+			Password string `json:"password"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		newEmail := strings.TrimSpace(input.NewEmail)
+
+		var user User
+		if err := db.First(&user, getUserIdFromToken(c)).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		// Accounts created through single sign-on have no password
+		if user.Password != "" && !checkCurrentPassword(c, db, guard, mail, &user, input.Password) {
+			return
+		}
+
+		if strings.EqualFold(newEmail, user.Email) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "This is already your email"})
+			return
+		}
+		if !checkNewEmail(c, db, policy, user, newEmail) {
+			return
+		}
+
+		confirmToken, confirmHash, err := newVerifyToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+		cancelToken, cancelHash, err := newVerifyToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate token"})
+			return
+		}
+
+		change := EmailChange{
+			UserID:       user.ID,
+			NewEmail:     newEmail,
+			ConfirmToken: confirmHash,
+			CancelToken:  cancelHash,
+			ExpiresAt:    time.Now().Add(emailChangeLifetime),
+		}
+
+		// Only one change can be pending, a new request replaces the last
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Unscoped().
+				Where("user_id = ? AND completed_at IS NULL AND cancelled_at IS NULL", user.ID).
+				Delete(&EmailChange{}).Error; err != nil {
+				return err
+			}
+			return tx.Create(&change).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to request email change"})
+			return
+		}
+
+		go func(user User, ip string) {
+			if err := mailer.SendTemplate(mail, "email_change_confirm", change.NewEmail, gin.H{
+				"Name":      user.Name,
+				"Email":     change.NewEmail,
+				"Link":      emailChangeLink(config, "confirm", confirmToken),
+				"ExpiresIn": "24 hours",
+			}); err != nil {
+				fmt.Println("Error sending email change confirmation:", err)
+			}
+			if err := mailer.SendTemplate(mail, "email_change_notice", user.Email, gin.H{
+				"Name":  user.Name,
+				"Email": change.NewEmail,
+				"IP":    ip,
+				"Link":  emailChangeLink(config, "cancel", cancelToken),
+			}); err != nil {
+				fmt.Println("Error sending email change notice:", err)
+			}
+		}(user, c.ClientIP())
+
+		response := gin.H{
+			"message": "Check your new inbox to confirm the change. A cancel link has been sent to your current address.",
+			"change":  change,
+		}
+		if config.IsDev() {
+			response["confirm_token"] = confirmToken
+			response["cancel_token"] = cancelToken
+		}
+		c.JSON(http.StatusAccepted, response)
+	}
+}
+
+// loadEmailChange finds the pending change a confirm or cancel token belongs to
+func loadEmailChange(c *gin.Context, db *gorm.DB, column string) (*EmailChange, bool) {
+	token := c.Query("token")
+	if token == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Token required"})
+		return nil, false
+	}
+
+	var change EmailChange
+	if err := db.Where(column+" = ? AND expires_at > ? AND completed_at IS NULL AND cancelled_at IS NULL", auth.HashToken(token), time.Now()).
+		First(&change).Error; err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link"})
+		return nil, false
+	}
+	return &change, true
+}
+
+func confirmEmailChange(db *gorm.DB, policy *DomainPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		change, ok := loadEmailChange(c, db, "confirm_token")
+		if !ok {
+			return
+		}
+
+		var user User
+		if err := db.First(&user, change.UserID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		// The address or the policy may have changed since the request
+		if !checkNewEmail(c, db, policy, user, change.NewEmail) {
+			return
+		}
+
+		oldEmail := user.Email
+		err := db.Transaction(func(tx *gorm.DB) error {
+			// Conditional so a cancel racing the confirm wins cleanly
+			result := tx.Model(&EmailChange{}).
+				Where("id = ? AND completed_at IS NULL AND cancelled_at IS NULL", change.ID).
+				Update("completed_at", time.Now())
+			if result.Error != nil {
+				return result.Error
+			}
+			if result.RowsAffected == 0 {
+				return errEmailChangeGone
+			}
+			if err := tx.Model(&user).Update("email", change.NewEmail).Error; err != nil {
+				return err
+			}
+			// The new address may have been attached as a secondary email
+			return tx.Unscoped().
+				Where("user_id = ? AND LOWER(email) = ?", user.ID, strings.ToLower(change.NewEmail)).
+				Delete(&UserEmail{}).Error
+		})
+		if errors.Is(err, errEmailChangeGone) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change email"})
+			return
+		}
+
+		// Access tokens carry the old address, log everything out
+		if err := revokeCredentials(db, user.ID, 0); err != nil {
+			fmt.Println("Error revoking sessions after email change:", err)
+		}
+
+		user.Email = change.NewEmail
+		recordSecurityEvent(db, c, EventEmailChanged, user.ID, user.Email, "from "+oldEmail)
+
+		applyAlumniTransition(c, db, policy, &user, oldEmail)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Email changed. Please log in again with your new address."})
+	}
+}
+
+func cancelEmailChange(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		change, ok := loadEmailChange(c, db, "cancel_token")
+		if !ok {
+			return
+		}
+
+		result := db.Model(&EmailChange{}).
+			Where("id = ? AND completed_at IS NULL AND cancelled_at IS NULL", change.ID).
+			Update("cancelled_at", time.Now())
+		if result.Error != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to cancel email change"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired link"})
+			return
+		}
+
+		// Whoever asked for the change may have been logged in as this user
+		if err := revokeCredentials(db, change.UserID, 0); err != nil {
+			fmt.Println("Error revoking sessions after cancelled email change:", err)
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Email change cancelled and all sessions logged out. Please reset your password if you didn't request it."})
+	}
+}
@@ -0,0 +1,325 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/stefvuck/forum/internal/auth"
+	"github.com/stefvuck/forum/internal/mailer"
+)
+
+// Extra addresses a user can attach, verified or not
+const maxSecondaryEmails = 5
+
+// emailTaken reports whether an address is another account's primary email
+// or one of its verified secondary emails. Unverified secondary addresses
+// don't count, otherwise anyone could squat an address by adding it.
+func emailTaken(db *gorm.DB, email string, exceptUserID uint) (bool, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+
+	var count int64
+	if err := db.Model(&User{}).
+		Where("LOWER(email) = ? AND id <> ?", email, exceptUserID).
+		Count(&count).Error; err != nil {
+		return false, err
+	}
+	if count > 0 {
+		return true, nil
+	}
+
+	err := db.Model(&UserEmail{}).
+		Where("LOWER(email) = ? AND verified = ? AND user_id <> ?", email, true, exceptUserID).
+		Count(&count).Error
+	return count > 0, err
+}
+
+func secondaryEmailLink(config Config, token string) string {
+	return config.APIUrl + "/api/auth/verify-secondary-email?token=" + url.QueryEscape(token)
+}
+
+func getUserEmails(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserIdFromToken(c)
+
+		var user User
+		if err := db.First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		var emails []UserEmail
+		if err := db.Where("user_id = ?", userID).Order("created_at").Find(&emails).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch emails"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"primary": user.Email,
+			"emails":  emails,
+		})
+	}
+}
+
+func addUserEmail(db *gorm.DB, config Config, mail mailer.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Email string `json:"email" binding:"required,email"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		address := strings.TrimSpace(input.Email)
+
+		userID := getUserIdFromToken(c)
+		var user User
+		if err := db.First(&user, userID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		if strings.EqualFold(address, user.Email) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "This is already your primary email"})
+			return
+		}
+
+		var existing int64
+		if err := db.Model(&UserEmail{}).
+			Where("user_id = ? AND LOWER(email) = ?", userID, strings.ToLower(address)).
+			Count(&existing).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add email"})
+			return
+		}
+		if existing > 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Email already added, remove it first to get a new verification link"})
+			return
+		}
+
+		var total int64
+		if err := db.Model(&UserEmail{}).Where("user_id = ?", userID).Count(&total).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add email"})
+			return
+		}
+		if total >= maxSecondaryEmails {
+			c.JSON(http.StatusBadRequest, gin.H{"error": fmt.Sprintf("You can add at most %d emails", maxSecondaryEmails)})
+			return
+		}
+
+		taken, err := emailTaken(db, address, userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add email"})
+			return
+		}
+		if taken {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Email is already in use"})
+			return
+		}
+
+		token, tokenHash, err := newVerifyToken()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate verification token"})
+			return
+		}
+
+		email := UserEmail{
+			UserID:        userID,
+			Email:         address,
+			VerifyToken:   tokenHash,
+			VerifyExpires: time.Now().Add(verifyTokenLifetime),
+		}
+		if err := db.Create(&email).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to add email"})
+			return
+		}
+
+		go func(name string) {
+			if err := mailer.SendTemplate(mail, "verify_secondary_email", email.Email, gin.H{
+				"Name":      name,
+				"Email":     email.Email,
+				"Link":      secondaryEmailLink(config, token),
+				"ExpiresIn": "48 hours",
+			}); err != nil {
+				fmt.Println("Error sending secondary email verification:", err)
+			}
+		}(user.Name)
+
+		response := gin.H{
+			"message": "Email added. Please check that inbox to verify it.",
+			"email":   email,
+		}
+		if config.IsDev() {
+			response["verify_token"] = token
+		}
+		c.JSON(http.StatusCreated, response)
+	}
+}
+
+func handleVerifySecondaryEmail(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		token := c.Query("token")
+		if token == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Verification token required"})
+			return
+		}
+
+		var email UserEmail
+		if err := db.Where("verify_token = ? AND verify_expires > ? AND verified = ?", auth.HashToken(token), time.Now(), false).
+			First(&email).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid or expired verification token"})
+			return
+		}
+
+		// Someone else may have registered or verified the address meanwhile
+		taken, err := emailTaken(db, email.Email, email.UserID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+			return
+		}
+		if taken {
+			c.JSON(http.StatusConflict, gin.H{"error": "Email is already in use by another account"})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(&email).Updates(map[string]interface{}{
+				"verified":     true,
+				"verify_token": "",
+			}).Error; err != nil {
+				return err
+			}
+			// Other accounts' pending claims on the address can never succeed now
+			return tx.Unscoped().
+				Where("LOWER(email) = ? AND user_id <> ? AND verified = ?", strings.ToLower(email.Email), email.UserID, false).
+				Delete(&UserEmail{}).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to verify email"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Email verified successfully"})
+	}
+}
+
+// loadUserEmail loads one of the current user's secondary emails from the :id param
+func loadUserEmail(c *gin.Context, db *gorm.DB) (*UserEmail, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid email ID"})
+		return nil, false
+	}
+
+	var email UserEmail
+	err = db.Where("id = ? AND user_id = ?", id, getUserIdFromToken(c)).First(&email).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Email not found"})
+		return nil, false
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch email"})
+		return nil, false
+	}
+	return &email, true
+}
+
+func makeEmailPrimary(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email, ok := loadUserEmail(c, db)
+		if !ok {
+			return
+		}
+		if !email.Verified {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Verify this email before making it your primary"})
+			return
+		}
+
+		var user User
+		if err := db.First(&user, email.UserID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		// Swap the addresses, the old primary stays on the account as a
+		// verified secondary email
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Unscoped().Delete(email).Error; err != nil {
+				return err
+			}
+			if err := tx.Create(&UserEmail{UserID: user.ID, Email: user.Email, Verified: true}).Error; err != nil {
+				return err
+			}
+			return tx.Model(&user).Update("email", email.Email).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to change primary email"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Primary email changed",
+			"primary": email.Email,
+		})
+	}
+}
+
+func removeUserEmail(db *gorm.DB, policy *DomainPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email, ok := loadUserEmail(c, db)
+		if !ok {
+			return
+		}
+
+		if err := db.Unscoped().Delete(email).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to remove email"})
+			return
+		}
+
+		response := gin.H{"message": "Email removed"}
+
+		// Unverified addresses never counted towards the user's role
+		if email.Verified {
+			var user User
+			if err := db.First(&user, email.UserID).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user"})
+				return
+			}
+			if applyAlumniTransition(c, db, policy, &user, email.Email) {
+				var role Role
+				db.First(&role, user.RoleID)
+				response["role"] = role
+				response["message"] = "Email removed. Your role is now " + role.Name + "."
+			}
+		}
+
+		c.JSON(http.StatusOK, response)
+	}
+}
+
+// applyAlumniTransition runs policy.AlumniTransition after removedEmail has
+// left the account and records any role change it makes, returning whether
+// there was one. The change is the server's, not the user's, so it's audited
+// under the system actor.
+func applyAlumniTransition(c *gin.Context, db *gorm.DB, policy *DomainPolicy, user *User, removedEmail string) bool {
+	previousRoleID := user.RoleID
+	changed, err := policy.AlumniTransition(user, removedEmail)
+	if err != nil {
+		fmt.Println("Error applying alumni transition:", err)
+		return false
+	}
+	if !changed {
+		return false
+	}
+
+	recordSecurityEvent(db, c, EventRoleChanged, user.ID, user.Email, "alumni transition")
+	recordSystemAudit(db, c, AuditUserRoleChanged, AuditTargetUser, user.ID,
+		gin.H{"role_id": previousRoleID}, gin.H{"role_id": user.RoleID, "reason": "alumni transition"})
+	return true
+}
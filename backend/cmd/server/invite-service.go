@@ -0,0 +1,134 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/stefvuck/forum/internal/auth"
+)
+
+var ErrInviteInvalid = errors.New("invalid or expired invite code")
+
+// splitSections normalises a list of section names, dropping blanks and duplicates
+func splitSections(sections []string) []string {
+	result := make([]string, 0, len(sections))
+	seen := make(map[string]bool)
+	for _, section := range sections {
+		section = strings.ToLower(strings.TrimSpace(section))
+		if section != "" && !seen[section] {
+			seen[section] = true
+			result = append(result, section)
+		}
+	}
+	return result
+}
+
+type InviteService struct {
+	db *gorm.DB
+}
+
+func NewInviteService(db *gorm.DB) *InviteService {
+	return &InviteService{db: db}
+}
+
+// Create issues an invite and returns it with the plaintext code, which is
+// never stored and can't be shown again
+func (s *InviteService) Create(createdBy uint, role Role, note string, sections []string, maxUses int, expiresAt *time.Time) (*Invite, string, error) {
+	random, err := auth.GenerateRandomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	code := strings.TrimRight(random, "=")
+
+	invite := &Invite{
+		CodeHash:    auth.HashToken(code),
+		Prefix:      code[:6],
+		Note:        note,
+		RoleID:      role.ID,
+		Role:        role,
+		Sections:    strings.Join(splitSections(sections), ","),
+		MaxUses:     maxUses,
+		ExpiresAt:   expiresAt,
+		CreatedByID: createdBy,
+	}
+	if err := s.db.Create(invite).Error; err != nil {
+		return nil, "", err
+	}
+	return invite, code, nil
+}
+
+// usable limits a query to invites that can still be redeemed
+func usable(db *gorm.DB) *gorm.DB {
+	return db.Where("revoked_at IS NULL AND uses < max_uses AND (expires_at IS NULL OR expires_at > ?)", time.Now())
+}
+
+// Lookup finds a usable invite by its plaintext code
+func (s *InviteService) Lookup(code string) (*Invite, error) {
+	var invite Invite
+	if err := usable(s.db.Preload("Role")).
+		Where("code_hash = ?", auth.HashToken(strings.TrimSpace(code))).
+		First(&invite).Error; err != nil {
+		return nil, ErrInviteInvalid
+	}
+	return &invite, nil
+}
+
+// Redeem uses up one redemption of the invite and creates the user with it,
+// failing with ErrInviteInvalid if someone else took the last use first
+func (s *InviteService) Redeem(invite *Invite, user *User) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		result := usable(tx.Model(&Invite{})).
+			Where("id = ?", invite.ID).
+			Update("uses", gorm.Expr("uses + 1"))
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ErrInviteInvalid
+		}
+
+		user.RoleID = invite.RoleID
+		user.AllowedSections = invite.Sections
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		return tx.Create(&InviteRedemption{InviteID: invite.ID, UserID: user.ID}).Error
+	})
+}
+
+// List returns every invite, newest first
+func (s *InviteService) List() ([]Invite, error) {
+	var invites []Invite
+	err := s.db.Preload("Role").Order("created_at DESC").Find(&invites).Error
+	return invites, err
+}
+
+// Get returns an invite with the users who redeemed it
+func (s *InviteService) Get(inviteID uint) (*Invite, error) {
+	var invite Invite
+	err := s.db.Preload("Role").
+		Preload("Redemptions", func(db *gorm.DB) *gorm.DB { return db.Order("created_at") }).
+		Preload("Redemptions.User").
+		First(&invite, inviteID).Error
+	if err != nil {
+		return nil, err
+	}
+	return &invite, nil
+}
+
+// Revoke stops an invite being used, existing accounts are unaffected
+func (s *InviteService) Revoke(inviteID uint) error {
+	result := s.db.Model(&Invite{}).
+		Where("id = ? AND revoked_at IS NULL", inviteID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// inviteLink opens the register form with the code filled in
+func inviteLink(config Config, code string) string {
+	return config.FrontendUrl + "/?invite=" + url.QueryEscape(code)
+}
+
+func getInvites(db *gorm.DB) gin.HandlerFunc {
+	inviteService := NewInviteService(db)
+
+	return func(c *gin.Context) {
+		invites, err := inviteService.List()
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invites"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"invites": invites})
+	}
+}
+
+func getInvite(db *gorm.DB) gin.HandlerFunc {
+	inviteService := NewInviteService(db)
+
+	return func(c *gin.Context) {
+		inviteID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite ID"})
+			return
+		}
+
+		invite, err := inviteService.Get(uint(inviteID))
+		if err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch invite"})
+			return
+		}
+
+		c.JSON(http.StatusOK, invite)
+	}
+}
+
+func createInvite(db *gorm.DB, config Config) gin.HandlerFunc {
+	inviteService := NewInviteService(db)
+
+	return func(c *gin.Context) {
+		var input struct {
+			RoleID        json.Number `json:"roleId" binding:"required"`
+			Note          string      `json:"note" binding:"max=200"`
+			Sections      []string    `json:"sections"`
+			MaxUses       int         `json:"max_uses" binding:"required,min=1,max=1000"`
+			ExpiresInDays int         `json:"expires_in_days" binding:"min=0,max=365"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		roleID, err := input.RoleID.Int64()
+		if err != nil || roleID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+			return
+		}
+		var role Role
+		if err := db.First(&role, roleID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role does not exist"})
+			return
+		}
+		// Staff roles are granted to known accounts, not handed out by link
+		if role.TwoFactorRequired() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invites can't grant this role, promote the user after they register"})
+			return
+		}
+
+		// Zero means the invite never expires
+		var expiresAt *time.Time
+		if input.ExpiresInDays > 0 {
+			t := time.Now().AddDate(0, 0, input.ExpiresInDays)
+			expiresAt = &t
+		}
+
+		invite, code, err := inviteService.Create(c.GetUint("userID"), role, strings.TrimSpace(input.Note), input.Sections, input.MaxUses, expiresAt)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create invite"})
+			return
+		}
+
+		recordAudit(db, c, AuditInviteCreated, AuditTargetInvite, invite.ID, nil, invite)
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "Copy this invite now, it won't be shown again",
+			"code":    code,
+			"link":    inviteLink(config, code),
+			"details": invite,
+		})
+	}
+}
+
+func revokeInvite(db *gorm.DB) gin.HandlerFunc {
+	inviteService := NewInviteService(db)
+
+	return func(c *gin.Context) {
+		inviteID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid invite ID"})
+			return
+		}
+
+		if err := inviteService.Revoke(uint(inviteID)); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Invite not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke invite"})
+			return
+		}
+
+		recordAudit(db, c, AuditInviteRevoked, AuditTargetInvite, uint(inviteID), nil, nil)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Invite revoked"})
+	}
+}
@@ -0,0 +1,20 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// startBackgroundJob runs fn every interval until the process exits, logging
+// any error under name
+func startBackgroundJob(name string, interval time.Duration, fn func() error) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for range ticker.C {
+			if err := fn(); err != nil {
+				fmt.Printf("Error running %s: %v\n", name, err)
+			}
+		}
+	}()
+}
@@ -0,0 +1,289 @@
+package main
+
+import (
+	"errors"
+	"math"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// AttemptRecord tracks failed logins for one key (an account or an IP)
+type AttemptRecord struct {
+	Failures    int
+	LastFailure time.Time
+	LockedUntil time.Time
+}
+
+// AttemptStore persists failed login attempts
+type AttemptStore interface {
+	Get(key string) (AttemptRecord, error)
+	// Update applies fn to the record for key atomically and stores the result
+	Update(key string, fn func(*AttemptRecord)) (AttemptRecord, error)
+	Reset(key string) error
+	// Prune removes records with no failures since before
+	Prune(before time.Time) error
+}
+
+/*
+
+In-memory store
+
+*/
+
+type MemoryAttemptStore struct {
+	mu      sync.Mutex
+	records map[string]AttemptRecord
+}
+
+func NewMemoryAttemptStore() *MemoryAttemptStore {
+	return &MemoryAttemptStore{records: make(map[string]AttemptRecord)}
+}
+
+func (s *MemoryAttemptStore) Get(key string) (AttemptRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.records[key], nil
+}
+
+func (s *MemoryAttemptStore) Update(key string, fn func(*AttemptRecord)) (AttemptRecord, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	record := s.records[key]
+	fn(&record)
+	s.records[key] = record
+	return record, nil
+}
+
+func (s *MemoryAttemptStore) Reset(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.records, key)
+	return nil
+}
+
+func (s *MemoryAttemptStore) Prune(before time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for key, record := range s.records {
+		if record.LastFailure.Before(before) && record.LockedUntil.Before(before) {
+			delete(s.records, key)
+		}
+	}
+	return nil
+}
+
+/*
+
+Postgres store
+
+*/
+
+type PostgresAttemptStore struct {
+	db *gorm.DB
+}
+
+func NewPostgresAttemptStore(db *gorm.DB) *PostgresAttemptStore {
+	return &PostgresAttemptStore{db: db}
+}
+
+func (s *PostgresAttemptStore) Get(key string) (AttemptRecord, error) {
+	var attempt LoginAttempt
+	if err := s.db.Where("key = ?", key).First(&attempt).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return AttemptRecord{}, nil
+		}
+		return AttemptRecord{}, err
+	}
+	return attempt.record(), nil
+}
+
+func (s *PostgresAttemptStore) Update(key string, fn func(*AttemptRecord)) (AttemptRecord, error) {
+	var record AttemptRecord
+	err := s.db.Transaction(func(tx *gorm.DB) error {
+		// Make sure the row exists so it can be locked
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&LoginAttempt{Key: key}).Error; err != nil {
+			return err
+		}
+
+		var attempt LoginAttempt
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("key = ?", key).First(&attempt).Error; err != nil {
+			return err
+		}
+
+		record = attempt.record()
+		fn(&record)
+
+		return tx.Model(&attempt).Updates(map[string]interface{}{
+			"failures":     record.Failures,
+			"last_failure": record.LastFailure,
+			"locked_until": record.LockedUntil,
+		}).Error
+	})
+	return record, err
+}
+
+func (s *PostgresAttemptStore) Reset(key string) error {
+	return s.db.Where("key = ?", key).Delete(&LoginAttempt{}).Error
+}
+
+func (s *PostgresAttemptStore) Prune(before time.Time) error {
+	return s.db.Where("last_failure < ? AND locked_until < ?", before, before).Delete(&LoginAttempt{}).Error
+}
+
+func (a LoginAttempt) record() AttemptRecord {
+	return AttemptRecord{
+		Failures:    a.Failures,
+		LastFailure: a.LastFailure,
+		LockedUntil: a.LockedUntil,
+	}
+}
+
+/*
+
+Lockout policy
+
+*/
+
+type LockoutPolicy struct {
+	FreeAttempts       int           // failures allowed before backoff starts
+	MaxAccountFailures int           // failures before an account is locked
+	MaxIPFailures      int           // failures before an IP is locked
+	BaseDelay          time.Duration // first backoff delay, doubled per failure
+	MaxDelay           time.Duration
+	LockoutDuration    time.Duration
+	Window             time.Duration // failures older than this are forgotten
+}
+
+func DefaultLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		FreeAttempts:       3,
+		MaxAccountFailures: 10,
+		MaxIPFailures:      50,
+		BaseDelay:          time.Second,
+		MaxDelay:           5 * time.Minute,
+		LockoutDuration:    15 * time.Minute,
+		Window:             time.Hour,
+	}
+}
+
+type LoginGuard struct {
+	store  AttemptStore
+	policy LockoutPolicy
+	now    func() time.Time // replaced in tests
+}
+
+func NewLoginGuard(store AttemptStore, policy LockoutPolicy) *LoginGuard {
+	return &LoginGuard{store: store, policy: policy, now: time.Now}
+}
+
+func accountKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipKey(ip string) string {
+	return "ip:" + ip
+}
+
+// Check returns how long the caller must wait before trying again, zero if
+// the attempt may go ahead
+func (g *LoginGuard) Check(email, ip string) (time.Duration, error) {
+	now := g.now()
+	var wait time.Duration
+
+	for _, key := range []string{accountKey(email), ipKey(ip)} {
+		record, err := g.store.Get(key)
+		if err != nil {
+			return 0, err
+		}
+		if d := g.retryAfter(record, now); d > wait {
+			wait = d
+		}
+	}
+	return wait, nil
+}
+
+func (g *LoginGuard) retryAfter(record AttemptRecord, now time.Time) time.Duration {
+	if record.LockedUntil.After(now) {
+		return record.LockedUntil.Sub(now)
+	}
+	if now.Sub(record.LastFailure) > g.policy.Window {
+		return 0
+	}
+	if next := record.LastFailure.Add(g.backoff(record.Failures)); next.After(now) {
+		return next.Sub(now)
+	}
+	return 0
+}
+
+// backoff returns the delay required after the given number of failures
+func (g *LoginGuard) backoff(failures int) time.Duration {
+	over := failures - g.policy.FreeAttempts
+	if over <= 0 {
+		return 0
+	}
+	delay := time.Duration(float64(g.policy.BaseDelay) * math.Pow(2, float64(over-1)))
+	if delay > g.policy.MaxDelay || delay <= 0 {
+		return g.policy.MaxDelay
+	}
+	return delay
+}
+
+// RecordFailure counts a failed login against the account and IP. It reports
+// whether this failure has just locked the account.
+func (g *LoginGuard) RecordFailure(email, ip string) (bool, error) {
+	now := g.now()
+	accountLocked := false
+
+	_, err := g.store.Update(accountKey(email), func(r *AttemptRecord) {
+		accountLocked = g.fail(r, now, g.policy.MaxAccountFailures)
+	})
+	if err != nil {
+		return false, err
+	}
+
+	_, err = g.store.Update(ipKey(ip), func(r *AttemptRecord) {
+		g.fail(r, now, g.policy.MaxIPFailures)
+	})
+	return accountLocked, err
+}
+
+// fail increments a record and locks it once max is reached, reporting
+// whether it became locked
+func (g *LoginGuard) fail(r *AttemptRecord, now time.Time, max int) bool {
+	if now.Sub(r.LastFailure) > g.policy.Window {
+		r.Failures = 0
+	}
+	r.Failures++
+	r.LastFailure = now
+
+	if r.Failures >= max && !r.LockedUntil.After(now) {
+		r.LockedUntil = now.Add(g.policy.LockoutDuration)
+		r.Failures = 0
+		return true
+	}
+	return false
+}
+
+// RecordSuccess clears the account's failures. The IP count is kept so an
+// attacker can't reset it by logging into their own account.
+func (g *LoginGuard) RecordSuccess(email string) error {
+	return g.store.Reset(accountKey(email))
+}
+
+// Unlock clears any lockout on an account
+func (g *LoginGuard) Unlock(email string) error {
+	return g.store.Reset(accountKey(email))
+}
+
+// StartCleanup periodically prunes stale records until the process exits
+func (g *LoginGuard) StartCleanup(interval time.Duration) {
+	startBackgroundJob("login attempt cleanup", interval, func() error {
+		return g.store.Prune(g.now().Add(-g.policy.Window))
+	})
+}
@@ -0,0 +1,253 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gorm.io/driver/postgres"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+)
+
+// fakeClock is a LoginGuard clock the test moves by hand
+type fakeClock struct{ now time.Time }
+
+func (c *fakeClock) Now() time.Time          { return c.now }
+func (c *fakeClock) Advance(d time.Duration) { c.now = c.now.Add(d) }
+
+func testLockoutPolicy() LockoutPolicy {
+	return LockoutPolicy{
+		FreeAttempts:       2,
+		MaxAccountFailures: 6,
+		MaxIPFailures:      10,
+		BaseDelay:          time.Second,
+		MaxDelay:           4 * time.Second,
+		LockoutDuration:    15 * time.Minute,
+		Window:             time.Hour,
+	}
+}
+
+func newTestLoginGuard() (*LoginGuard, *fakeClock) {
+	clock := &fakeClock{now: time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)}
+	guard := NewLoginGuard(NewMemoryAttemptStore(), testLockoutPolicy())
+	guard.now = clock.Now
+	return guard, clock
+}
+
+func checkWait(t *testing.T, guard *LoginGuard, email, ip string, want time.Duration) {
+	t.Helper()
+	wait, err := guard.Check(email, ip)
+	if err != nil {
+		t.Fatalf("Check: %v", err)
+	}
+	if wait != want {
+		t.Errorf("Check(%s, %s) = %v, want %v", email, ip, wait, want)
+	}
+}
+
+func recordFailure(t *testing.T, guard *LoginGuard, email, ip string) bool {
+	t.Helper()
+	locked, err := guard.RecordFailure(email, ip)
+	if err != nil {
+		t.Fatalf("RecordFailure: %v", err)
+	}
+	return locked
+}
+
+func TestLoginGuardBackoff(t *testing.T) {
+	// Wait after each failure: free attempts, then doubling up to MaxDelay
+	want := []time.Duration{0, 0, time.Second, 2 * time.Second, 4 * time.Second}
+	guard, _ := newTestLoginGuard()
+
+	for i, delay := range want {
+		if locked := recordFailure(t, guard, "jane@student.gla.ac.uk", "10.0.0.1"); locked {
+			t.Fatalf("locked after %d failures", i+1)
+		}
+		checkWait(t, guard, "jane@student.gla.ac.uk", "10.0.0.1", delay)
+	}
+}
+
+func TestLoginGuardBackoffCapped(t *testing.T) {
+	guard, _ := newTestLoginGuard()
+	guard.policy.MaxAccountFailures = 100
+	guard.policy.MaxIPFailures = 100
+	for i := 0; i < 40; i++ {
+		recordFailure(t, guard, "jane@student.gla.ac.uk", "10.0.0.1")
+	}
+	// 2^37 seconds would overflow without the cap
+	checkWait(t, guard, "jane@student.gla.ac.uk", "10.0.0.1", 4*time.Second)
+}
+
+func TestLoginGuardWaitCountsDown(t *testing.T) {
+	guard, clock := newTestLoginGuard()
+	for i := 0; i < 4; i++ {
+		recordFailure(t, guard, "jane@student.gla.ac.uk", "10.0.0.1")
+	}
+	clock.Advance(1500 * time.Millisecond)
+	checkWait(t, guard, "jane@student.gla.ac.uk", "10.0.0.1", 500*time.Millisecond)
+	clock.Advance(time.Second)
+	checkWait(t, guard, "jane@student.gla.ac.uk", "10.0.0.1", 0)
+}
+
+func TestLoginGuardLockout(t *testing.T) {
+	guard, clock := newTestLoginGuard()
+	for i := 1; i <= 6; i++ {
+		clock.Advance(10 * time.Second) // past any backoff
+		locked := recordFailure(t, guard, "jane@student.gla.ac.uk", "10.0.0.1")
+		if locked != (i == 6) {
+			t.Fatalf("failure %d: locked = %v", i, locked)
+		}
+	}
+
+	checkWait(t, guard, "jane@student.gla.ac.uk", "10.0.0.1", 15*time.Minute)
+	// Any IP, it's the account that is locked
+	checkWait(t, guard, "JANE@student.gla.ac.uk ", "10.0.0.2", 15*time.Minute)
+	checkWait(t, guard, "someone@student.gla.ac.uk", "10.0.0.2", 0)
+
+	// Failing during the lockout doesn't extend it
+	clock.Advance(5 * time.Minute)
+	recordFailure(t, guard, "jane@student.gla.ac.uk", "10.0.0.2")
+	checkWait(t, guard, "jane@student.gla.ac.uk", "10.0.0.3", 10*time.Minute)
+
+	clock.Advance(10 * time.Minute)
+	checkWait(t, guard, "jane@student.gla.ac.uk", "10.0.0.3", 0)
+}
+
+func TestLoginGuardWindow(t *testing.T) {
+	guard, clock := newTestLoginGuard()
+	for i := 0; i < 5; i++ {
+		clock.Advance(10 * time.Second)
+		recordFailure(t, guard, "jane@student.gla.ac.uk", "10.0.0.1")
+	}
+
+	// Old failures are forgotten, so the next ones start from scratch
+	clock.Advance(time.Hour + time.Second)
+	checkWait(t, guard, "jane@student.gla.ac.uk", "10.0.0.1", 0)
+	if locked := recordFailure(t, guard, "jane@student.gla.ac.uk", "10.0.0.1"); locked {
+		t.Error("locked by failures outside the window")
+	}
+	checkWait(t, guard, "jane@student.gla.ac.uk", "10.0.0.1", 0)
+}
+
+func TestLoginGuardSuccessResetsAccountOnly(t *testing.T) {
+	guard, _ := newTestLoginGuard()
+	for i := 0; i < 4; i++ {
+		recordFailure(t, guard, "jane@student.gla.ac.uk", "10.0.0.1")
+	}
+	if err := guard.RecordSuccess("Jane@student.gla.ac.uk"); err != nil {
+		t.Fatalf("RecordSuccess: %v", err)
+	}
+	checkWait(t, guard, "jane@student.gla.ac.uk", "10.0.0.2", 0)
+	// The IP keeps its count, logging into your own account doesn't clear it
+	checkWait(t, guard, "jane@student.gla.ac.uk", "10.0.0.1", 2*time.Second)
+}
+
+func TestLoginGuardIPLockout(t *testing.T) {
+	guard, clock := newTestLoginGuard()
+	// Spread over accounts so none of them locks
+	for i := 0; i < 10; i++ {
+		clock.Advance(10 * time.Second)
+		recordFailure(t, guard, string(rune('a'+i))+"@student.gla.ac.uk", "10.0.0.1")
+	}
+	checkWait(t, guard, "new@student.gla.ac.uk", "10.0.0.1", 15*time.Minute)
+	checkWait(t, guard, "new@student.gla.ac.uk", "10.0.0.2", 0)
+}
+
+func TestLoginGuardUnlock(t *testing.T) {
+	guard, clock := newTestLoginGuard()
+	for i := 0; i < 6; i++ {
+		clock.Advance(10 * time.Second)
+		recordFailure(t, guard, "jane@student.gla.ac.uk", "10.0.0.1")
+	}
+	if err := guard.Unlock("jane@student.gla.ac.uk"); err != nil {
+		t.Fatalf("Unlock: %v", err)
+	}
+	checkWait(t, guard, "jane@student.gla.ac.uk", "10.0.0.2", 0)
+}
+
+// testAttemptStoreContract checks the behaviour LoginGuard relies on from
+// every AttemptStore
+func testAttemptStoreContract(t *testing.T, store AttemptStore) {
+	now := time.Now().UTC().Truncate(time.Second)
+
+	record, err := store.Get("account:missing@test")
+	if err != nil || record != (AttemptRecord{}) {
+		t.Fatalf("Get(missing) = %+v, %v, want an empty record", record, err)
+	}
+
+	for i := 1; i <= 3; i++ {
+		record, err = store.Update("account:jane@test", func(r *AttemptRecord) {
+			r.Failures++
+			r.LastFailure = now
+		})
+		if err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if record.Failures != i {
+			t.Fatalf("Update returned %d failures, want %d", record.Failures, i)
+		}
+	}
+	record, err = store.Get("account:jane@test")
+	if err != nil || record.Failures != 3 || !record.LastFailure.Equal(now) {
+		t.Fatalf("Get after Update = %+v, %v", record, err)
+	}
+
+	if err := store.Reset("account:jane@test"); err != nil {
+		t.Fatalf("Reset: %v", err)
+	}
+	if record, _ := store.Get("account:jane@test"); record != (AttemptRecord{}) {
+		t.Errorf("Get after Reset = %+v, want an empty record", record)
+	}
+	if err := store.Reset("account:missing@test"); err != nil {
+		t.Errorf("Reset(missing): %v", err)
+	}
+
+	old := now.Add(-2 * time.Hour)
+	set := func(key string, r AttemptRecord) {
+		if _, err := store.Update(key, func(stored *AttemptRecord) { *stored = r }); err != nil {
+			t.Fatalf("Update(%s): %v", key, err)
+		}
+	}
+	set("ip:stale", AttemptRecord{Failures: 1, LastFailure: old})
+	set("ip:recent", AttemptRecord{Failures: 1, LastFailure: now})
+	set("ip:locked", AttemptRecord{LastFailure: old, LockedUntil: now.Add(time.Hour)})
+
+	if err := store.Prune(now.Add(-time.Hour)); err != nil {
+		t.Fatalf("Prune: %v", err)
+	}
+	if record, _ := store.Get("ip:stale"); record.Failures != 0 {
+		t.Error("Prune kept a stale record")
+	}
+	if record, _ := store.Get("ip:recent"); record.Failures != 1 {
+		t.Error("Prune removed a recent record")
+	}
+	if record, _ := store.Get("ip:locked"); !record.LockedUntil.After(now) {
+		t.Error("Prune removed a locked record")
+	}
+}
+
+func TestMemoryAttemptStore(t *testing.T) {
+	testAttemptStoreContract(t, NewMemoryAttemptStore())
+}
+
+// Needs a scratch database, e.g.
+// TEST_DATABASE_URL="host=localhost user=forumuser password=yourpassword dbname=forum_test sslmode=disable"
+func TestPostgresAttemptStore(t *testing.T) {
+	dsn := os.Getenv("TEST_DATABASE_URL")
+	if dsn == "" {
+		t.Skip("TEST_DATABASE_URL not set")
+	}
+	db, err := gorm.Open(postgres.Open(dsn), &gorm.Config{Logger: logger.Default.LogMode(logger.Silent)})
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	if err := db.AutoMigrate(&LoginAttempt{}); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	clear := func() { db.Where("1 = 1").Delete(&LoginAttempt{}) }
+	clear()
+	t.Cleanup(clear)
+
+	testAttemptStoreContract(t, NewPostgresAttemptStore(db))
+}
@@ -1,20 +1,22 @@
 package main
 
 import (
-	"crypto/rand"
-	"encoding/base64"
+	"errors"
 	"fmt"
+	"math"
+	"net/url"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
-	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
 	"github.com/stefvuck/forum/internal/auth"
+	"github.com/stefvuck/forum/internal/mailer"
 )
 
 // TODO:
@@ -113,30 +115,215 @@ func seedDatabase(db *gorm.DB) {
 	fmt.Println("Test data seeded successfully!")
 }
 
+// Only allowed when APP_ENV is development
+const defaultJWTSecret = "your_jwt_secret_key"
+
 // Configuration struct to hold all environment variables
 type Config struct {
-	DBHost      string
-	DBUser      string
-	DBPassword  string
-	DBName      string
-	DBPort      string
-	JWTSecret   string
-	APIUrl      string
-	FrontendUrl string
+	Env          string
+	DBHost       string
+	DBUser       string
+	DBPassword   string
+	DBName       string
+	DBPort       string
+	JWTSecret    string
+	JWTKeyID     string
+	JWTOldKeys   map[string]string // retired keys by ID, only used to verify tokens
+	APIUrl       string
+	FrontendUrl  string
+	SMTPHost     string
+	SMTPPort     string
+	SMTPUser     string
+	SMTPPassword string
+	MailFrom     string
+
+	AllowedEmailDomains     map[string]string // domain to default role name, seeded into the database
+	UnknownDomainPolicy     string            // "reject" or "approval"
+	PendingRegistrationRole string
+	AlumniEmailDomains      map[string]string // domain to the role its users get when they remove that address
+	RestrictedSections      map[string]string // section to the "+" separated roles given access, seeded into the database
+
+	OIDCIssuer       string // single sign-on is disabled when empty
+	OIDCClientID     string
+	OIDCClientSecret string
+	OIDCRedirectURL  string
+
+	UnverifiedGraceHours int // unverified accounts are deleted after this long
+
+	SecurityEventRetentionDays int // 0 keeps security events forever
+	AccountDeletionGraceDays   int // how long users have to cancel deleting their account
+
+	AuthCookies    bool // issue tokens as HttpOnly cookies instead of in response bodies
+	CookieDomain   string
+	CookieSecure   bool
+	CookieSameSite string // "lax", "strict" or "none"
+
+	LoginAttemptStore   string // "postgres" or "memory"
+	LoginMaxFailures    int
+	LoginLockoutMinutes int
+
+	PasswordHash   string // "bcrypt" or "argon2id", existing hashes are upgraded on login
+	BcryptCost     int
+	Argon2Time     int
+	Argon2MemoryKB int
+	Argon2Threads  int
+
+	CommonPasswordsFile string // extra breached password list, on top of the built in one
 }
 
 // LoadConfig loads configuration from environment variables
 func LoadConfig() Config {
-	return Config{
-		DBHost:      getEnv("DB_HOST", "localhost"),
-		DBUser:      getEnv("DB_USER", "forumuser"),
-		DBPassword:  getEnv("DB_PASSWORD", "yourpassword"),
-		DBName:      getEnv("DB_NAME", "drones_forum"),
-		DBPort:      getEnv("DB_PORT", "5432"),
-		JWTSecret:   getEnv("JWT_SECRET", "your_jwt_secret_key"),
-		APIUrl:      getEnv("API_URL", "http://localhost:8080"),
-		FrontendUrl: getEnv("FRONTEND_URL", "http://localhost:5173"),
+	config := Config{
+		Env:          getEnv("APP_ENV", "development"),
+		DBHost:       getEnv("DB_HOST", "localhost"),
+		DBUser:       getEnv("DB_USER", "forumuser"),
+		DBPassword:   getEnv("DB_PASSWORD", "yourpassword"),
+		DBName:       getEnv("DB_NAME", "drones_forum"),
+		DBPort:       getEnv("DB_PORT", "5432"),
+		JWTSecret:    getEnv("JWT_SECRET", defaultJWTSecret),
+		JWTKeyID:     getEnv("JWT_KEY_ID", "primary"),
+		JWTOldKeys:   parsePairList(getEnv("JWT_OLD_KEYS", "")),
+		APIUrl:       getEnv("API_URL", "http://localhost:8080"),
+		FrontendUrl:  getEnv("FRONTEND_URL", "http://localhost:5173"),
+		SMTPHost:     getEnv("SMTP_HOST", ""),
+		SMTPPort:     getEnv("SMTP_PORT", "1025"),
+		SMTPUser:     getEnv("SMTP_USER", ""),
+		SMTPPassword: getEnv("SMTP_PASSWORD", ""),
+		MailFrom:     getEnv("MAIL_FROM", "GU Drones Forum <noreply@gudrones.com>"),
+
+		AllowedEmailDomains:     parsePairList(getEnv("ALLOWED_EMAIL_DOMAINS", "student.gla.ac.uk:member,glasgow.ac.uk:verified_member")),
+		UnknownDomainPolicy:     getEnv("UNKNOWN_DOMAIN_POLICY", UnknownDomainReject),
+		PendingRegistrationRole: getEnv("PENDING_REGISTRATION_ROLE", "member"),
+		AlumniEmailDomains:      parsePairList(getEnv("ALUMNI_EMAIL_DOMAINS", "student.gla.ac.uk:alumni")),
+		RestrictedSections:      parsePairList(getEnv("RESTRICTED_SECTIONS", "team:admin+moderator")),
+
+		OIDCIssuer:       getEnv("OIDC_ISSUER", ""),
+		OIDCClientID:     getEnv("OIDC_CLIENT_ID", ""),
+		OIDCClientSecret: getEnv("OIDC_CLIENT_SECRET", ""),
+		OIDCRedirectURL:  getEnv("OIDC_REDIRECT_URL", getEnv("API_URL", "http://localhost:8080")+"/api/auth/oidc/callback"),
+
+		UnverifiedGraceHours: getEnvInt("UNVERIFIED_GRACE_HOURS", 7*24),
+
+		SecurityEventRetentionDays: getEnvInt("SECURITY_EVENT_RETENTION_DAYS", 90),
+		AccountDeletionGraceDays:   getEnvInt("ACCOUNT_DELETION_GRACE_DAYS", 14),
+
+		AuthCookies:    getEnv("AUTH_COOKIES", "false") == "true",
+		CookieDomain:   getEnv("COOKIE_DOMAIN", ""),
+		CookieSecure:   getEnv("COOKIE_SECURE", "true") == "true",
+		CookieSameSite: getEnv("COOKIE_SAMESITE", "lax"),
+
+		LoginAttemptStore:   getEnv("LOGIN_ATTEMPT_STORE", "postgres"),
+		LoginMaxFailures:    getEnvInt("LOGIN_MAX_FAILURES", 10),
+		LoginLockoutMinutes: getEnvInt("LOGIN_LOCKOUT_MINUTES", 15),
+
+		PasswordHash:   getEnv("PASSWORD_HASH", auth.HashBcrypt),
+		BcryptCost:     getEnvInt("BCRYPT_COST", 12),
+		Argon2Time:     getEnvInt("ARGON2_TIME", 3),
+		Argon2MemoryKB: getEnvInt("ARGON2_MEMORY_KB", 64*1024),
+		Argon2Threads:  getEnvInt("ARGON2_THREADS", 2),
+
+		CommonPasswordsFile: getEnv("COMMON_PASSWORDS_FILE", ""),
+	}
+
+	// Caught here rather than on the first email, which would just be logged
+	if _, err := mailer.EnvelopeAddress(config.MailFrom); err != nil {
+		panic("Invalid MAIL_FROM: " + err.Error())
+	}
+	return config
+}
+
+// getEnvInt gets an integer environment variable with a fallback
+func getEnvInt(key string, fallback int) int {
+	value, exists := os.LookupEnv(key)
+	if !exists {
+		return fallback
+	}
+	parsed, err := strconv.Atoi(value)
+	if err != nil {
+		fmt.Printf("Invalid value for %s, using default %d\n", key, fallback)
+		return fallback
+	}
+	return parsed
+}
+
+// newLoginGuard builds the login brute-force protection from config
+func newLoginGuard(db *gorm.DB, config Config) *LoginGuard {
+	policy := DefaultLockoutPolicy()
+	if config.LoginMaxFailures > 0 {
+		policy.MaxAccountFailures = config.LoginMaxFailures
 	}
+	if config.LoginLockoutMinutes > 0 {
+		policy.LockoutDuration = time.Duration(config.LoginLockoutMinutes) * time.Minute
+	}
+
+	var store AttemptStore
+	if config.LoginAttemptStore == "memory" {
+		store = NewMemoryAttemptStore()
+	} else {
+		store = NewPostgresAttemptStore(db)
+	}
+	return NewLoginGuard(store, policy)
+}
+
+// parsePairList parses "key1:value1,key2:value2" into a map
+func parsePairList(value string) map[string]string {
+	pairs := make(map[string]string)
+	for _, entry := range strings.Split(value, ",") {
+		key, val, found := strings.Cut(strings.TrimSpace(entry), ":")
+		if !found || key == "" || val == "" {
+			continue
+		}
+		pairs[key] = val
+	}
+	return pairs
+}
+
+// IsDev reports whether the server is running in development mode
+func (c Config) IsDev() bool {
+	return c.Env == "development"
+}
+
+// initJWTKeys loads the signing keys into the auth package
+func initJWTKeys(config Config) error {
+	if !config.IsDev() && config.JWTSecret == defaultJWTSecret {
+		return fmt.Errorf("JWT_SECRET must be changed from the default outside development")
+	}
+
+	keyset := map[string][]byte{config.JWTKeyID: []byte(config.JWTSecret)}
+	for kid, secret := range config.JWTOldKeys {
+		if kid == config.JWTKeyID {
+			return fmt.Errorf("JWT_OLD_KEYS contains the active key ID %q", kid)
+		}
+		if !config.IsDev() && secret == defaultJWTSecret {
+			return fmt.Errorf("JWT_OLD_KEYS must not contain the default secret outside development")
+		}
+		keyset[kid] = []byte(secret)
+	}
+
+	return auth.SetKeys(config.JWTKeyID, keyset)
+}
+
+// initPasswordHashing sets the algorithm and cost used for new password hashes
+func initPasswordHashing(config Config) error {
+	if config.Argon2Time < 1 || config.Argon2MemoryKB < 1 || config.Argon2Threads < 1 || config.Argon2Threads > 255 {
+		return fmt.Errorf("ARGON2_TIME, ARGON2_MEMORY_KB and ARGON2_THREADS must be positive, with at most 255 threads")
+	}
+	return auth.SetHashParams(auth.HashParams{
+		Algorithm:     config.PasswordHash,
+		BcryptCost:    config.BcryptCost,
+		Argon2Time:    uint32(config.Argon2Time),
+		Argon2Memory:  uint32(config.Argon2MemoryKB),
+		Argon2Threads: uint8(config.Argon2Threads),
+	})
+}
+
+// newMailer returns an SMTP mailer, or an in-memory one when no SMTP host is set
+func newMailer(config Config) mailer.Mailer {
+	if config.SMTPHost == "" {
+		fmt.Println("SMTP_HOST not set, emails will be kept in memory and not delivered")
+		return mailer.NewMemoryMailer()
+	}
+	return mailer.NewSMTPMailer(config.SMTPHost, config.SMTPPort, config.SMTPUser, config.SMTPPassword, config.MailFrom)
 }
 
 // getEnv gets an environment variable with a fallback
@@ -181,6 +368,21 @@ func main() {
 	// Load configuration
 	config := LoadConfig()
 
+	// Load JWT signing keys before anything can issue a token
+	if err := initJWTKeys(config); err != nil {
+		panic("Failed to load JWT keys: " + err.Error())
+	}
+	if err := initPasswordHashing(config); err != nil {
+		panic("Invalid password hashing settings: " + err.Error())
+	}
+	if config.CommonPasswordsFile != "" {
+		added, err := auth.LoadCommonPasswordsFile(config.CommonPasswordsFile)
+		if err != nil {
+			panic("Failed to load COMMON_PASSWORDS_FILE: " + err.Error())
+		}
+		fmt.Printf("Loaded %d extra common passwords from %s\n", added, config.CommonPasswordsFile)
+	}
+
 	// Initialize database connection with retries
 	db, err := initDB(config)
 	if err != nil {
@@ -192,10 +394,36 @@ func main() {
 		&User{},   // Users depend on roles
 		&Thread{}, // Threads depend on users
 		&Reply{},  // Replies depend on threads and users
+		&Session{},
+		&LoginAttempt{},
+		&RecoveryCode{},
+		&OIDCLoginState{},
+		&EmailDomain{},
+		&AccessToken{},
+		&UserEmail{},
+		&EmailChange{},
+		&Invite{},
+		&InviteRedemption{},
+		&SecurityEvent{},
+		&SectionRule{},
+		&Suspension{},
+		&AuditLog{},
 	); err != nil {
 		panic("Failed to migrate database: " + err.Error())
 	}
 
+	if err := protectAuditLog(db); err != nil {
+		panic("Failed to protect audit log: " + err.Error())
+	}
+
+	if err := hashLegacyVerifyTokens(db); err != nil {
+		panic("Failed to hash verification tokens: " + err.Error())
+	}
+
+	if err := normaliseThreadSections(db); err != nil {
+		panic("Failed to normalise thread sections: " + err.Error())
+	}
+
 	// Check if the database is empty before seeding
 	var count int64
 	db.Model(&User{}).Count(&count) // Check if there are any users
@@ -211,6 +439,51 @@ func main() {
 		panic("Failed to initialize roles: " + err.Error())
 	}
 
+	// Seed allowed registration domains
+	if err := seedEmailDomains(db, config.AllowedEmailDomains); err != nil {
+		panic("Failed to seed email domains: " + err.Error())
+	}
+	if err := seedAlumniRoles(db, config.AlumniEmailDomains); err != nil {
+		panic("Failed to seed alumni roles: " + err.Error())
+	}
+	domainPolicy := NewDomainPolicy(db, config)
+
+	// Seed access rules for restricted sections
+	if err := seedSectionRules(db, config.RestrictedSections); err != nil {
+		panic("Failed to seed section rules: " + err.Error())
+	}
+
+	// Initialize mailer
+	mail := newMailer(config)
+
+	// Initialize login brute-force protection
+	loginGuard := newLoginGuard(db, config)
+	loginGuard.StartCleanup(time.Hour)
+
+	// Prune old security events
+	if config.SecurityEventRetentionDays > 0 {
+		startSecurityEventPruning(db, time.Duration(config.SecurityEventRetentionDays)*24*time.Hour)
+	}
+
+	// Anonymise accounts whose deletion grace period has passed
+	startAccountDeletion(db)
+
+	// Mark suspensions as lifted once they expire
+	startSuspensionExpiry(db)
+
+	// Delete accounts that never verified their email
+	if config.UnverifiedGraceHours > 0 {
+		startUnverifiedPurge(db, time.Duration(config.UnverifiedGraceHours)*time.Hour)
+	}
+
+	// Limit unauthenticated endpoints that send email. Each has its own
+	// budget so resending verification links can't use up password resets.
+	resendLimiter := NewRateLimiter(5, time.Hour)
+	forgotPasswordLimiter := NewRateLimiter(5, time.Hour)
+
+	// Initialize university single sign-on, if configured
+	oidcProvider := newOIDCProvider(config)
+
 	// Initialize Gin router
 	r := gin.Default()
 
@@ -218,47 +491,111 @@ func main() {
 	r.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{config.FrontendUrl},
 		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS", "PATCH"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
+		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", csrfHeaderName},
 		ExposeHeaders:    []string{"Content-Length"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
 
+	// Tell token issuing handlers whether to use cookies
+	r.Use(UseCookieSettings(newCookieSettings(config)))
+
 	// Define API routes
 	api := r.Group("/api")
 	{
 		// Authentication routes
 		auth := api.Group("/auth")
 		{
-			auth.POST("/login", handleLogin(db))
-			auth.POST("/register", handleRegister(db))
+			auth.POST("/login", handleLogin(db, mail, loginGuard))
+			auth.POST("/register", handleRegister(db, config, mail, domainPolicy))
 			auth.GET("/verify", handleVerifyEmail(db))
-			auth.POST("/validate", validateToken)
+			auth.POST("/resend-verification", RateLimitByIP(resendLimiter), handleResendVerification(db, config, mail))
+			auth.GET("/verify-secondary-email", handleVerifySecondaryEmail(db))
+			auth.GET("/email-change/confirm", confirmEmailChange(db, domainPolicy))
+			auth.GET("/email-change/cancel", cancelEmailChange(db))
+			auth.POST("/forgot-password", RateLimitByIP(forgotPasswordLimiter), handleForgotPassword(db, config, mail))
+			auth.POST("/reset-password", handleResetPassword(db))
+			auth.POST("/validate", validateToken(db))
+			auth.POST("/refresh", handleRefreshToken(db))
+			auth.POST("/logout", AuthMiddleware(db), handleLogout(db))
+			auth.POST("/2fa/verify", handleVerifyTwoFactor(db, mail, loginGuard))
+			auth.POST("/2fa/setup", handleLoginTwoFactorSetup(db))
+			auth.POST("/2fa/enable", handleLoginTwoFactorEnable(db))
+			auth.GET("/oidc/login", handleOIDCLogin(db, oidcProvider))
+			auth.GET("/oidc/callback", handleOIDCCallback(db, config, oidcProvider, domainPolicy))
 		}
 
 		// Protected routes
 		protected := api.Group("/")
-		protected.Use(AuthMiddleware())
+		protected.Use(AuthMiddleware(db))
 		{
 			// Thread routes
 			protected.GET("/sections/:section/threads", getThreadsBySection(db))
 			protected.GET("/threads/:id", getThread(db))
-			protected.POST("/threads", createThread(db))
+			protected.POST("/threads", RequirePermission(db, PermCreateThreads), createThread(db))
+			protected.DELETE("/threads/:id", deleteThread(db))
 
 			// Reply routes
-			protected.POST("/threads/:id/replies", createReply(db))
+			protected.POST("/threads/:id/replies", RequirePermission(db, PermReply), createReply(db))
 			protected.GET("/threads/:id/replies", getReplies(db))
+			protected.DELETE("/threads/:id/replies/:replyId", deleteReply(db))
 			protected.GET("/search", handleSearch(db))
+			protected.GET("/sections/access", getMySectionAccess(db))
 
 			// User and role management routes
 			protected.GET("/profile", getCurrentUserProfile(db))
 			protected.PATCH("/profile", updateUserProfile(db))
 			protected.GET("/profile/stats", getCurrentUserStats(db))
-			protected.PATCH("/users/:userId/role", updateUserRole(db))
+			protected.PUT("/profile/password", changePassword(db, mail, loginGuard))
+			protected.GET("/profile/sessions", getSessions(db))
+			protected.DELETE("/profile/sessions/:id", revokeSession(db))
+			protected.GET("/profile/2fa", getTwoFactorStatus(db))
+			protected.POST("/profile/2fa/setup", setupTwoFactor(db))
+			protected.POST("/profile/2fa/enable", enableTwoFactor(db))
+			protected.POST("/profile/2fa/disable", disableTwoFactor(db))
+			protected.POST("/profile/2fa/recovery-codes", regenerateRecoveryCodes(db))
+			protected.GET("/profile/tokens", getAccessTokens(db))
+			protected.POST("/profile/tokens", createAccessToken(db))
+			protected.DELETE("/profile/tokens/:id", revokeAccessToken(db))
+			protected.POST("/profile/email", requestEmailChange(db, config, mail, loginGuard, domainPolicy))
+			protected.GET("/profile/security-events", getSecurityEvents(db))
+			protected.POST("/profile/deletion", requestAccountDeletion(db, config, mail, loginGuard))
+			protected.DELETE("/profile/deletion", cancelAccountDeletion(db))
+			protected.GET("/profile/emails", getUserEmails(db))
+			protected.POST("/profile/emails", addUserEmail(db, config, mail))
+			protected.PUT("/profile/emails/:id/primary", makeEmailPrimary(db))
+			protected.DELETE("/profile/emails/:id", removeUserEmail(db, domainPolicy))
+			protected.PATCH("/users/:userId/role", RequirePermission(db, PermManageRoles), updateUserRole(db))
 			protected.GET("/roles", getRoles(db))
-			protected.GET("/users", handleGetUsers(db))
+			protected.GET("/roles/permissions", getPermissionCatalogue())
+			protected.POST("/roles", RequirePermission(db, PermManageRoles), createRole(db))
+			protected.PUT("/roles/:id", RequirePermission(db, PermManageRoles), updateRole(db))
+			protected.DELETE("/roles/:id", RequirePermission(db, PermManageRoles), deleteRole(db))
+			protected.GET("/users", RequirePermission(db, PermManageUsers), handleGetUsers(db))
 			protected.GET("/users/:id/public-profile", getPublicUserProfile(db))
 			protected.GET("/users/:id/activity", getUserActivity(db))
+			protected.DELETE("/users/:userId/lockout", RequirePermission(db, PermManageUsers), clearUserLockout(db, loginGuard))
+
+			// Registration policy routes
+			protected.GET("/admin/email-domains", RequirePermission(db, PermManageUsers), getEmailDomains(db))
+			protected.POST("/admin/email-domains", RequirePermission(db, PermManageUsers), createEmailDomain(db))
+			protected.DELETE("/admin/email-domains/:id", RequirePermission(db, PermManageUsers), deleteEmailDomain(db))
+			protected.GET("/admin/registrations", RequirePermission(db, PermManageUsers), getPendingRegistrations(db))
+			protected.POST("/admin/registrations/:userId/approve", RequirePermission(db, PermManageUsers), approveRegistration(db, mail))
+			protected.POST("/admin/registrations/:userId/reject", RequirePermission(db, PermManageUsers), rejectRegistration(db))
+			protected.GET("/admin/security-events", RequirePermission(db, PermManageUsers), getAllSecurityEvents(db))
+			protected.GET("/admin/invites", RequirePermission(db, PermManageUsers), getInvites(db))
+			protected.GET("/admin/invites/:id", RequirePermission(db, PermManageUsers), getInvite(db))
+			protected.POST("/admin/invites", RequirePermission(db, PermManageUsers), createInvite(db, config))
+			protected.DELETE("/admin/invites/:id", RequirePermission(db, PermManageUsers), revokeInvite(db))
+			protected.GET("/admin/section-rules", RequirePermission(db, PermManageRoles), getSectionRules(db))
+			protected.PUT("/admin/section-rules", RequirePermission(db, PermManageRoles), setSectionRule(db))
+			protected.DELETE("/admin/section-rules/:id", RequirePermission(db, PermManageRoles), deleteSectionRule(db))
+			protected.GET("/admin/users/:userId/suspensions", RequirePermission(db, PermSuspendUsers), getUserSuspensions(db))
+			protected.POST("/admin/users/:userId/suspensions", RequirePermission(db, PermSuspendUsers), suspendUser(db))
+			protected.DELETE("/admin/users/:userId/suspensions/:id", RequirePermission(db, PermSuspendUsers), liftSuspension(db))
+			protected.GET("/admin/audit-log", RequirePermission(db, PermManageUsers), getAuditLog(db))
+			protected.GET("/admin/audit-log/export", RequirePermission(db, PermManageUsers), exportAuditLog(db))
 		}
 	}
 
@@ -267,26 +604,11 @@ func main() {
 	r.Run(":" + port)
 }
 
-// Helper function for getting UserID from token
+// Helper function for getting UserID from token, as set by AuthMiddleware.
+// Returns 0 if the request wasn't authenticated.
 
 func getUserIdFromToken(c *gin.Context) uint {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		return 1 // or handle the error later
-	}
-
-	tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
-	claims := &auth.Claims{}
-
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return auth.JwtKey, nil
-	})
-
-	if err != nil || !token.Valid {
-		return 1 // or handle the error later
-	}
-
-	return claims.UserID // Return the user ID from the claims
+	return c.GetUint("userID")
 }
 
 /*
@@ -295,12 +617,20 @@ Login/Register Handling
 
 */
 
-func handleRegister(db *gorm.DB) gin.HandlerFunc {
+// verificationLink builds the link to handleVerifyEmail sent in verification emails
+func verificationLink(config Config, token string) string {
+	return config.APIUrl + "/api/auth/verify?token=" + url.QueryEscape(token)
+}
+
+func handleRegister(db *gorm.DB, config Config, mail mailer.Mailer, policy *DomainPolicy) gin.HandlerFunc {
+	inviteService := NewInviteService(db)
+
 	return func(c *gin.Context) {
 		var input struct {
-			Email    string `json:"email" binding:"required,email"`
-			Password string `json:"password" binding:"required,min=8"`
-			Name     string `json:"name" binding:"required"`
+			Email      string `json:"email" binding:"required,email"`
+			Password   string `json:"password" binding:"required"`
+			Name       string `json:"name" binding:"required"`
+			InviteCode string `json:"invite_code"`
 		}
 
 		if err := c.ShouldBindJSON(&input); err != nil {
@@ -308,15 +638,58 @@ func handleRegister(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if !strings.HasSuffix(input.Email, "@student.gla.ac.uk") {
-			c.JSON(400, gin.H{"error": "Must use a Glasgow University email"})
+		if !checkPasswordPolicy(c, input.Password, input.Name, input.Email) {
 			return
 		}
 
-		// Get the default member role
-		var memberRole Role
-		if err := db.Where("name = ?", "member").First(&memberRole).Error; err != nil {
-			c.JSON(500, gin.H{"error": "Failed to get default role"})
+		// An invite picks the role itself and skips the domain check,
+		// otherwise the email domain decides the role and whether an admin
+		// must approve
+		var invite *Invite
+		var decision *RegistrationDecision
+		var err error
+		if input.InviteCode != "" {
+			invite, err = inviteService.Lookup(input.InviteCode)
+			if err != nil {
+				c.JSON(400, gin.H{"error": "Invalid or expired invite code"})
+				return
+			}
+			decision = &RegistrationDecision{Role: invite.Role, Status: ApprovalApproved}
+		} else {
+			decision, err = policy.Evaluate(input.Email)
+			if err != nil {
+				if errors.Is(err, ErrDomainNotAllowed) {
+					c.JSON(400, gin.H{"error": "Registration is not open to this email domain"})
+					return
+				}
+				c.JSON(500, gin.H{"error": "Failed to get default role"})
+				return
+			}
+		}
+
+		// Unverified accounts past the grace period would be purged anyway,
+		// so clear one now rather than making the user wait for the job
+		var existing User
+		if err := db.Where("LOWER(email) = ?", strings.ToLower(input.Email)).First(&existing).Error; err == nil {
+			grace := time.Duration(config.UnverifiedGraceHours) * time.Hour
+			if existing.Verified || grace <= 0 || time.Since(existing.CreatedAt) < grace {
+				c.JSON(400, gin.H{"error": "Email already registered"})
+				return
+			}
+			if _, err := purgeUnverifiedUsers(db.Where("id = ?", existing.ID), time.Now().Add(-grace)); err != nil {
+				c.JSON(500, gin.H{"error": "Failed to register"})
+				return
+			}
+		}
+
+		// Verified secondary emails belong to their account too
+		taken, err := emailTaken(db, input.Email, existing.ID)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to register"})
+			return
+		}
+		if taken {
+			c.JSON(400, gin.H{"error": "Email already registered"})
 			return
 		}
 
@@ -327,38 +700,92 @@ func handleRegister(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Generate verification token
-		verifyToken := make([]byte, 32)
-		if _, err := rand.Read(verifyToken); err != nil {
+		// Generate verification token, only its hash is stored
+		token, tokenHash, err := newVerifyToken()
+		if err != nil {
 			c.JSON(500, gin.H{"error": "Failed to generate verification token"})
 			return
 		}
-		token := base64.URLEncoding.EncodeToString(verifyToken)
 
 		user := User{
-			Email:         input.Email,
-			Name:          input.Name,
-			Password:      hashedPassword,
-			RoleID:        memberRole.ID, // Use the role ID
-			Verified:      false,
-			VerifyToken:   token,
-			VerifyExpires: time.Now().Add(48 * time.Hour),
+			Email:          input.Email,
+			Name:           input.Name,
+			Password:       hashedPassword,
+			RoleID:         decision.Role.ID,
+			ApprovalStatus: decision.Status,
+			Verified:       false,
+			VerifyToken:    tokenHash,
+			VerifyExpires:  time.Now().Add(verifyTokenLifetime),
+			VerifySentAt:   time.Now(),
 		}
 
-		if err := db.Create(&user).Error; err != nil {
+		if invite != nil {
+			if err := inviteService.Redeem(invite, &user); err != nil {
+				if errors.Is(err, ErrInviteInvalid) {
+					c.JSON(400, gin.H{"error": "Invalid or expired invite code"})
+					return
+				}
+				c.JSON(400, gin.H{"error": "Email already registered"})
+				return
+			}
+		} else if err := db.Create(&user).Error; err != nil {
 			c.JSON(400, gin.H{"error": "Email already registered"})
 			return
 		}
 
-		// TODO: Send verification email
-		c.JSON(201, gin.H{
-			"message":      "Registration successful. Please check your email to verify your account.",
-			"verify_token": token, // Remove this in production
-		})
+		// Send verification email, the account stays unverified if this fails
+		sendVerificationEmail(mail, config, user, token)
+
+		response := gin.H{
+			"message": "Registration successful. Please check your email to verify your account.",
+		}
+		if decision.Status == ApprovalPending {
+			response["message"] = "Registration successful. Please check your email to verify your account. An admin must also approve your registration before you can log in."
+			response["approval_status"] = ApprovalPending
+		}
+		// Only expose the token in development, where there may be no mail server
+		if config.IsDev() {
+			response["verify_token"] = token
+		}
+		c.JSON(201, response)
 	}
 }
 
-func handleLogin(db *gorm.DB) gin.HandlerFunc {
+// loginFailed records a failed attempt and, if it locked the account, emails the owner
+func loginFailed(c *gin.Context, db *gorm.DB, guard *LoginGuard, mail mailer.Mailer, email string, user *User, reason string) {
+	var userID uint
+	if user != nil {
+		userID = user.ID
+	}
+
+	locked, err := guard.RecordFailure(email, c.ClientIP())
+	if err != nil {
+		fmt.Println("Error recording failed login:", err)
+		recordSecurityEvent(db, c, EventLoginFailure, userID, email, reason)
+		return
+	}
+	if locked {
+		reason += ", account locked"
+	}
+	recordSecurityEvent(db, c, EventLoginFailure, userID, email, reason)
+
+	if locked && user != nil {
+		go func(user User, ip string) {
+			if err := mailer.SendTemplate(mail, "account_locked", user.Email, gin.H{
+				"Name":     user.Name,
+				"IP":       ip,
+				"Duration": guard.policy.LockoutDuration.String(),
+			}); err != nil {
+				fmt.Println("Error sending lockout email:", err)
+			}
+		}(*user, c.ClientIP())
+	}
+}
+
+func handleLogin(db *gorm.DB, mail mailer.Mailer, guard *LoginGuard) gin.HandlerFunc {
+	sessionService := NewSessionService(db)
+	suspensionService := NewSuspensionService(db)
+
 	return func(c *gin.Context) {
 		var input struct {
 			Email    string `json:"email" binding:"required,email"`
@@ -370,8 +797,25 @@ func handleLogin(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Refuse early while the account or IP is backing off or locked
+		wait, err := guard.Check(input.Email, c.ClientIP())
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check login attempts"})
+			return
+		}
+		if wait > 0 {
+			retryAfter := int(math.Ceil(wait.Seconds()))
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(429, gin.H{
+				"error":       "Too many failed login attempts. Please try again later.",
+				"retry_after": retryAfter,
+			})
+			return
+		}
+
 		var user User
 		if err := db.Where("email = ?", input.Email).First(&user).Error; err != nil {
+			loginFailed(c, db, guard, mail, input.Email, nil, "unknown account")
 			c.JSON(401, gin.H{"error": "Invalid credentials"})
 			return
 		}
@@ -387,26 +831,57 @@ func handleLogin(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		if !auth.CheckPasswordHash(input.Password, user.Password) {
+		if user.ApprovalStatus == ApprovalPending {
+			c.JSON(403, gin.H{"error": "Your registration is awaiting approval by an admin"})
+			return
+		}
+
+		ok, needsRehash := auth.CheckPasswordHash(input.Password, user.Password)
+		if !ok {
+			loginFailed(c, db, guard, mail, input.Email, &user, "wrong password")
 			c.JSON(401, gin.H{"error": "Invalid credentials"})
 			return
 		}
 
-		token, err := auth.GenerateToken(user.ID, user.Email)
+		// Hashing settings have changed since this hash was made, we only
+		// see the plaintext now so upgrade it. Failing here isn't fatal.
+		if needsRehash {
+			upgradePasswordHash(db, &user, input.Password)
+		}
+
+		if err := guard.RecordSuccess(input.Email); err != nil {
+			fmt.Println("Error clearing login attempts:", err)
+		}
+
+		// Checked after the password so it doesn't reveal the account exists
+		suspension, err := suspensionService.Active(user.ID)
 		if err != nil {
-			c.JSON(500, gin.H{"error": "Failed to generate token"})
+			c.JSON(500, gin.H{"error": "Failed to check account status"})
+			return
+		}
+		if suspension != nil && suspension.Scope == SuspensionFull {
+			c.JSON(403, suspendedResponse(suspension))
 			return
 		}
 
-		c.JSON(200, gin.H{
-			"token": token,
-			"user": gin.H{
-				"id":    user.ID,
-				"email": user.Email,
-				"name":  user.Name,
-				"role":  user.Role,
-			},
-		})
+		// Second step required, the client exchanges the challenge token and a
+		// code at /auth/2fa/verify (or enrols first if its role requires 2FA)
+		if user.TOTPEnabled || user.Role.TwoFactorRequired() {
+			challengeToken, err := auth.GenerateChallengeToken(user.ID, user.Email)
+			if err != nil {
+				c.JSON(500, gin.H{"error": "Failed to generate token"})
+				return
+			}
+
+			c.JSON(200, gin.H{
+				"two_factor_required":       user.TOTPEnabled,
+				"two_factor_setup_required": !user.TOTPEnabled,
+				"challenge_token":           challengeToken,
+			})
+			return
+		}
+
+		completeLogin(c, sessionService, user, nil)
 	}
 }
 
@@ -419,7 +894,7 @@ func handleVerifyEmail(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		var user User
-		result := db.Where("verify_token = ? AND verify_expires > ?", token, time.Now()).First(&user)
+		result := db.Where("verify_token = ? AND verify_expires > ?", auth.HashToken(token), time.Now()).First(&user)
 		if result.Error != nil {
 			c.JSON(400, gin.H{"error": "Invalid or expired verification token"})
 			return
@@ -442,53 +917,115 @@ General Auth Middleware Logic
 
 */
 
-func AuthMiddleware() gin.HandlerFunc {
+func AuthMiddleware(db *gorm.DB) gin.HandlerFunc {
+	sessionService := NewSessionService(db)
+	tokenService := NewAccessTokenService(db)
+	suspensionService := NewSuspensionService(db)
+
 	return func(c *gin.Context) {
 		authHeader := c.GetHeader("Authorization")
+		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
+
+		// Fall back to the cookie, which needs the CSRF token to go with it
 		if authHeader == "" {
-			c.JSON(401, gin.H{"error": "Authorization header required"})
-			c.Abort()
-			return
+			cookie, err := c.Cookie(accessCookieName)
+			if err != nil || cookie == "" {
+				c.JSON(401, gin.H{"error": "Authorization header required"})
+				c.Abort()
+				return
+			}
+			if !validCSRF(c) {
+				c.JSON(403, gin.H{"error": "Invalid CSRF token"})
+				c.Abort()
+				return
+			}
+			tokenString = cookie
 		}
 
-		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
-		claims := &auth.Claims{} // Use auth.Claims instead of local Claims
+		// Personal access tokens only reach routes listed in routeScopes
+		if isAccessToken(tokenString) {
+			token, user, err := tokenService.Authenticate(tokenString)
+			if err != nil {
+				c.JSON(401, gin.H{"error": "Invalid token"})
+				c.Abort()
+				return
+			}
 
-		token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-			return auth.JwtKey, nil
-		})
+			scope, allowed := routeScopes[c.Request.Method+" "+c.FullPath()]
+			if !allowed || !token.HasScope(scope) {
+				c.JSON(403, gin.H{
+					"error": "Access token does not have the required scope",
+					"scope": scope,
+				})
+				c.Abort()
+				return
+			}
+
+			if !enforceSuspension(c, suspensionService, user.ID) {
+				c.Abort()
+				return
+			}
 
-		if err != nil || !token.Valid {
+			c.Set("userID", user.ID)
+			c.Set("userEmail", user.Email)
+			c.Set("accessTokenID", token.ID)
+			c.Next()
+			return
+		}
+
+		claims, err := auth.ParseToken(tokenString)
+		if err != nil {
 			c.JSON(401, gin.H{"error": "Invalid token"})
 			c.Abort()
 			return
 		}
 
+		// Reject tokens whose session has been logged out or revoked
+		if err := sessionService.Validate(claims.SessionID, claims.UserID); err != nil {
+			c.JSON(401, gin.H{"error": "Session expired or revoked"})
+			c.Abort()
+			return
+		}
+
+		if !enforceSuspension(c, suspensionService, claims.UserID) {
+			c.Abort()
+			return
+		}
+
 		c.Set("userID", claims.UserID)
 		c.Set("userEmail", claims.Email)
+		c.Set("sessionID", claims.SessionID)
 		c.Next()
 	}
 }
 
 // ValidateToken checks if the provided token is valid
-func validateToken(c *gin.Context) {
-	authHeader := c.GetHeader("Authorization")
-	if authHeader == "" {
-		c.JSON(401, gin.H{"error": "Authorization header required"})
-		return
-	}
+func validateToken(db *gorm.DB) gin.HandlerFunc {
+	sessionService := NewSessionService(db)
 
-	tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
-	claims := &auth.Claims{}
+	return func(c *gin.Context) {
+		authHeader := c.GetHeader("Authorization")
+		tokenString := strings.Replace(authHeader, "Bearer ", "", 1)
+		if authHeader == "" {
+			cookie, err := c.Cookie(accessCookieName)
+			if err != nil || cookie == "" {
+				c.JSON(401, gin.H{"error": "Authorization header required"})
+				return
+			}
+			tokenString = cookie
+		}
 
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		return auth.JwtKey, nil
-	})
+		claims, err := auth.ParseToken(tokenString)
+		if err != nil {
+			c.JSON(401, gin.H{"error": "Invalid token"})
+			return
+		}
 
-	if err != nil || !token.Valid {
-		c.JSON(401, gin.H{"error": "Invalid token"})
-		return
-	}
+		if err := sessionService.Validate(claims.SessionID, claims.UserID); err != nil {
+			c.JSON(401, gin.H{"error": "Invalid token"})
+			return
+		}
 
-	c.JSON(200, gin.H{"valid": true}) // Token is valid
+		c.JSON(200, gin.H{"valid": true}) // Token is valid
+	}
 }
@@ -0,0 +1,331 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/stefvuck/forum/internal/auth"
+	"github.com/stefvuck/forum/internal/oidc"
+)
+
+// How long a user has to finish logging in at the provider
+const oidcStateLifetime = 10 * time.Minute
+
+// The state is also kept in a cookie so a callback only completes in the
+// browser that started the login. Without it anyone could start a login and
+// send the callback link to someone else, logging them in as the attacker.
+const (
+	oidcStateCookieName = "gud_oidc_state"
+	oidcStateCookiePath = "/api/auth/oidc"
+)
+
+// setOIDCStateCookie ties a login to this browser. Lax rather than Strict,
+// the callback is a cross-site redirect from the provider.
+func setOIDCStateCookie(c *gin.Context, state string, maxAge time.Duration) {
+	settings := cookieSettings(c)
+	http.SetCookie(c.Writer, &http.Cookie{
+		Name:     oidcStateCookieName,
+		Value:    state,
+		Path:     oidcStateCookiePath,
+		Domain:   settings.Domain,
+		MaxAge:   int(maxAge.Seconds()),
+		Secure:   settings.Secure,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// checkOIDCStateCookie reports whether the callback's state matches the one
+// this browser was given, and clears the cookie either way
+func checkOIDCStateCookie(c *gin.Context, state string) bool {
+	cookie, err := c.Cookie(oidcStateCookieName)
+	setOIDCStateCookie(c, "", -1)
+	if err != nil || cookie == "" {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(state)) == 1
+}
+
+// newOIDCProvider returns nil when single sign-on is not configured
+func newOIDCProvider(config Config) *oidc.Provider {
+	if config.OIDCIssuer == "" || config.OIDCClientID == "" {
+		return nil
+	}
+	return oidc.NewProvider(oidc.Config{
+		Issuer:       config.OIDCIssuer,
+		ClientID:     config.OIDCClientID,
+		ClientSecret: config.OIDCClientSecret,
+		RedirectURL:  config.OIDCRedirectURL,
+	}, nil)
+}
+
+// oidcRedirect sends the browser back to the frontend, passing the result in
+// the URL fragment so tokens never reach server logs
+func oidcRedirect(c *gin.Context, config Config, result url.Values) {
+	c.Redirect(302, config.FrontendUrl+"/oidc/callback#"+result.Encode())
+}
+
+func oidcError(c *gin.Context, config Config, message string) {
+	oidcRedirect(c, config, url.Values{"error": {message}})
+}
+
+func handleOIDCLogin(db *gorm.DB, provider *oidc.Provider) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if provider == nil {
+			c.JSON(404, gin.H{"error": "Single sign-on is not enabled"})
+			return
+		}
+
+		state, err := oidc.RandomString()
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to start login"})
+			return
+		}
+		nonce, err := oidc.RandomString()
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to start login"})
+			return
+		}
+		verifier, err := oidc.RandomString()
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to start login"})
+			return
+		}
+
+		// Clear out logins that were abandoned at the provider
+		db.Where("expires_at < ?", time.Now()).Delete(&OIDCLoginState{})
+
+		loginState := OIDCLoginState{
+			State:        auth.HashToken(state),
+			Nonce:        nonce,
+			CodeVerifier: verifier,
+			ExpiresAt:    time.Now().Add(oidcStateLifetime),
+		}
+		if err := db.Create(&loginState).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to start login"})
+			return
+		}
+
+		authURL, err := provider.AuthCodeURL(c.Request.Context(), state, nonce, verifier)
+		if err != nil {
+			fmt.Println("Error building OIDC login URL:", err)
+			c.JSON(502, gin.H{"error": "Identity provider unavailable"})
+			return
+		}
+
+		setOIDCStateCookie(c, state, oidcStateLifetime)
+		c.Redirect(302, authURL)
+	}
+}
+
+func handleOIDCCallback(db *gorm.DB, config Config, provider *oidc.Provider, policy *DomainPolicy) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if provider == nil {
+			c.JSON(404, gin.H{"error": "Single sign-on is not enabled"})
+			return
+		}
+
+		if providerError := c.Query("error"); providerError != "" {
+			oidcError(c, config, "Login was cancelled or refused by the identity provider")
+			return
+		}
+
+		state, code := c.Query("state"), c.Query("code")
+		if state == "" || code == "" {
+			oidcError(c, config, "Invalid login response")
+			return
+		}
+		if !checkOIDCStateCookie(c, state) {
+			oidcError(c, config, "This login was started in a different browser, please try again")
+			return
+		}
+
+		// States are single use, delete it as it is read
+		var loginState OIDCLoginState
+		result := db.Where("state = ?", auth.HashToken(state)).Limit(1).Find(&loginState)
+		if result.Error != nil || result.RowsAffected == 0 {
+			oidcError(c, config, "Login session expired, please try again")
+			return
+		}
+		if err := db.Delete(&loginState).Error; err != nil {
+			oidcError(c, config, "Login session expired, please try again")
+			return
+		}
+		if time.Now().After(loginState.ExpiresAt) {
+			oidcError(c, config, "Login session expired, please try again")
+			return
+		}
+
+		claims, err := provider.Exchange(c.Request.Context(), code, loginState.CodeVerifier, loginState.Nonce)
+		if err != nil {
+			fmt.Println("Error completing OIDC login:", err)
+			oidcError(c, config, "Could not verify your login with the identity provider")
+			return
+		}
+		if claims.Email == "" || !claims.EmailVerified {
+			oidcError(c, config, "Your identity provider did not confirm your email address")
+			return
+		}
+
+		user, err := findOrCreateOIDCUser(db, policy, claims)
+		if err != nil {
+			oidcError(c, config, err.Error())
+			return
+		}
+
+		if user.ApprovalStatus == ApprovalPending {
+			oidcError(c, config, "Your registration is awaiting approval by an admin")
+			return
+		}
+
+		suspension, err := NewSuspensionService(db).Active(user.ID)
+		if err != nil {
+			oidcError(c, config, "Failed to check account status")
+			return
+		}
+		if suspension != nil && suspension.Scope == SuspensionFull {
+			oidcError(c, config, "Your account has been suspended: "+suspension.Reason)
+			return
+		}
+
+		// SSO replaces the password step only, 2FA still applies
+		if user.TOTPEnabled || user.Role.TwoFactorRequired() {
+			challengeToken, err := auth.GenerateChallengeToken(user.ID, user.Email)
+			if err != nil {
+				oidcError(c, config, "Failed to generate token")
+				return
+			}
+			oidcRedirect(c, config, url.Values{
+				"challenge_token":           {challengeToken},
+				"two_factor_required":       {fmt.Sprint(user.TOTPEnabled)},
+				"two_factor_setup_required": {fmt.Sprint(!user.TOTPEnabled)},
+			})
+			return
+		}
+
+		session, refreshToken, err := NewSessionService(db).CreateSession(user.ID, c.Request.UserAgent(), c.ClientIP())
+		if err != nil {
+			oidcError(c, config, "Failed to create session")
+			return
+		}
+		tokens, err := issueTokens(*user, session, refreshToken)
+		if err != nil {
+			oidcError(c, config, "Failed to generate token")
+			return
+		}
+
+		if err := writeAuthCookies(c, tokens); err != nil {
+			oidcError(c, config, "Failed to generate token")
+			return
+		}
+
+		recordSecurityEvent(db, c, EventLoginSuccess, user.ID, user.Email, "single sign-on")
+
+		// In cookie mode only the CSRF token is left in the response
+		values := url.Values{}
+		for _, key := range []string{"token", "refresh_token", "csrf_token"} {
+			if value, ok := tokens[key].(string); ok {
+				values.Set(key, value)
+			}
+		}
+		oidcRedirect(c, config, values)
+	}
+}
+
+// linkOIDCAccount attaches the provider identity to an existing account. The
+// provider has verified the address, so the account is verified too. If it
+// wasn't already, whoever registered it never proved they own the address
+// and may have been someone else setting up a password to get in once the
+// real owner signs in, so their password and anything else they could log
+// in with is thrown away.
+func linkOIDCAccount(db *gorm.DB, user *User, subject string) error {
+	updates := map[string]interface{}{
+		"oidc_subject": subject,
+		"verified":     true,
+		"verify_token": "",
+	}
+	if user.Verified {
+		return db.Model(user).Updates(updates).Error
+	}
+
+	updates["password"] = ""
+	updates["reset_token"] = ""
+	updates["totp_secret"] = ""
+	updates["totp_enabled"] = false
+	return db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(updates).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", user.ID).Delete(&RecoveryCode{}).Error; err != nil {
+			return err
+		}
+		return revokeCredentials(tx, user.ID, 0)
+	})
+}
+
+// findOrCreateOIDCUser resolves the provider identity to a forum user,
+// linking an existing account with the same email on first SSO login
+func findOrCreateOIDCUser(db *gorm.DB, policy *DomainPolicy, claims *oidc.IDTokenClaims) (*User, error) {
+	var user User
+	err := db.Preload("Role").Where("oidc_subject = ?", claims.Subject).First(&user).Error
+	if err == nil {
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("Failed to look up account")
+	}
+
+	email := strings.ToLower(claims.Email)
+	// Graduates may have moved their student address to a secondary email
+	err = db.Preload("Role").
+		Where("LOWER(email) = ?", email).
+		Or("id IN (SELECT user_id FROM user_emails WHERE LOWER(email) = ? AND verified = ? AND deleted_at IS NULL)", email, true).
+		First(&user).Error
+	if err == nil {
+		if user.OIDCSubject != "" {
+			return nil, errors.New("This email is already linked to a different university account")
+		}
+		if err := linkOIDCAccount(db, &user, claims.Subject); err != nil {
+			return nil, errors.New("Failed to link account")
+		}
+		return &user, nil
+	}
+	if !errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, errors.New("Failed to look up account")
+	}
+
+	decision, err := policy.Evaluate(email)
+	if err != nil {
+		if errors.Is(err, ErrDomainNotAllowed) {
+			return nil, errors.New("Registration is not open to this email domain")
+		}
+		return nil, errors.New("Failed to get default role")
+	}
+
+	name := claims.Name
+	if name == "" {
+		name = strings.Split(email, "@")[0]
+	}
+
+	user = User{
+		Email:          email,
+		Name:           name,
+		RoleID:         decision.Role.ID,
+		ApprovalStatus: decision.Status,
+		Verified:       true,
+		OIDCSubject:    claims.Subject,
+	}
+	if err := db.Create(&user).Error; err != nil {
+		return nil, errors.New("Failed to create account")
+	}
+	user.Role = decision.Role
+	return &user, nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/stefvuck/forum/internal/oidc"
+)
+
+func oidcStateContext(cookie string) (*gin.Context, *httptest.ResponseRecorder) {
+	gin.SetMode(gin.TestMode)
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/api/auth/oidc/callback", nil)
+	if cookie != "" {
+		c.Request.AddCookie(&http.Cookie{Name: oidcStateCookieName, Value: cookie})
+	}
+	return c, w
+}
+
+func TestCheckOIDCStateCookie(t *testing.T) {
+	tests := []struct {
+		name, cookie, state string
+		want                bool
+	}{
+		{"matching", "abc123", "abc123", true},
+		{"different browser", "", "abc123", false},
+		{"someone else's login", "abc123", "xyz789", false},
+	}
+	for _, tt := range tests {
+		c, w := oidcStateContext(tt.cookie)
+		if got := checkOIDCStateCookie(c, tt.state); got != tt.want {
+			t.Errorf("%s: checkOIDCStateCookie = %v, want %v", tt.name, got, tt.want)
+		}
+		// The cookie is single use like the state itself
+		if !strings.Contains(w.Header().Get("Set-Cookie"), oidcStateCookieName+"=;") {
+			t.Errorf("%s: state cookie not cleared", tt.name)
+		}
+	}
+}
+
+func TestOIDCCallbackRejectsStateFromAnotherBrowser(t *testing.T) {
+	config := Config{FrontendUrl: "http://forum.test"}
+	provider := oidc.NewProvider(oidc.Config{Issuer: "http://idp.test", ClientID: "forum"}, nil)
+
+	// Rejected before the database or the provider are touched
+	c, w := oidcStateContext("")
+	c.Request.URL.RawQuery = "code=stolen&state=attackers-state"
+	handleOIDCCallback(nil, config, provider, nil)(c)
+
+	if w.Code != http.StatusFound {
+		t.Fatalf("status = %d, want a redirect", w.Code)
+	}
+	location, err := url.Parse(w.Header().Get("Location"))
+	if err != nil {
+		t.Fatalf("bad redirect: %v", err)
+	}
+	fragment, _ := url.ParseQuery(location.Fragment)
+	if fragment.Get("error") == "" || fragment.Get("token") != "" {
+		t.Errorf("redirected to %s, want an error and no token", location)
+	}
+}
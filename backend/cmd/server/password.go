@@ -0,0 +1,269 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/stefvuck/forum/internal/auth"
+	"github.com/stefvuck/forum/internal/mailer"
+)
+
+const resetTokenLifetime = time.Hour
+
+// Same response whether or not the email exists, so this can't be used to
+// find out who is registered
+const forgotPasswordMessage = "If an account exists for that email, a password reset link has been sent."
+
+// resetLink builds the frontend link sent in password reset emails
+func resetLink(config Config, token string) string {
+	return config.FrontendUrl + "/reset-password?token=" + url.QueryEscape(token)
+}
+
+func handleForgotPassword(db *gorm.DB, config Config, mail mailer.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Email string `json:"email" binding:"required,email"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		var user User
+		if err := db.Where("email = ?", input.Email).First(&user).Error; err != nil {
+			c.JSON(200, gin.H{"message": forgotPasswordMessage})
+			return
+		}
+
+		token, err := auth.GenerateRandomToken()
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to generate reset token"})
+			return
+		}
+
+		// Only the hash is stored, a new request replaces any older token
+		if err := db.Model(&user).Updates(map[string]interface{}{
+			"reset_token":   auth.HashToken(token),
+			"reset_expires": time.Now().Add(resetTokenLifetime),
+		}).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to generate reset token"})
+			return
+		}
+
+		// Send in the background so response time doesn't reveal whether the email exists
+		go func(user User) {
+			if err := mailer.SendTemplate(mail, "password_reset", user.Email, gin.H{
+				"Name":      user.Name,
+				"Link":      resetLink(config, token),
+				"ExpiresIn": "1 hour",
+			}); err != nil {
+				fmt.Println("Error sending password reset email:", err)
+			}
+		}(user)
+
+		c.JSON(200, gin.H{"message": forgotPasswordMessage})
+	}
+}
+
+// upgradePasswordHash rehashes a correct password with the current settings.
+// Matching on the old hash avoids overwriting a password changed meanwhile.
+func upgradePasswordHash(db *gorm.DB, user *User, password string) {
+	hashedPassword, err := auth.HashPassword(password)
+	if err != nil {
+		fmt.Println("Error rehashing password:", err)
+		return
+	}
+	result := db.Model(&User{}).
+		Where("id = ? AND password = ?", user.ID, user.Password).
+		Update("password", hashedPassword)
+	if result.Error != nil {
+		fmt.Println("Error upgrading password hash:", result.Error)
+		return
+	}
+	user.Password = hashedPassword
+}
+
+// passwordPolicy is applied wherever a user picks a new password
+var passwordPolicy = auth.DefaultPasswordPolicy()
+
+// checkPasswordPolicy responds with every rule the password breaks and
+// returns false, so the frontend can show them all at once
+func checkPasswordPolicy(c *gin.Context, password string, userInputs ...string) bool {
+	violations := passwordPolicy.Check(password, userInputs...)
+	if len(violations) == 0 {
+		return true
+	}
+	c.JSON(400, gin.H{
+		"error":   "Password does not meet the requirements",
+		"reasons": violations,
+	})
+	return false
+}
+
+// revokeCredentials ends every session except keepSessionID and revokes all
+// personal access tokens, used whenever a password changes
+func revokeCredentials(db *gorm.DB, userID, keepSessionID uint) error {
+	if err := NewSessionService(db).RevokeAll(userID, keepSessionID); err != nil {
+		return err
+	}
+	return NewAccessTokenService(db).RevokeAll(userID)
+}
+
+func handleResetPassword(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Token    string `json:"token" binding:"required"`
+			Password string `json:"password" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		tokenHash := auth.HashToken(input.Token)
+
+		var user User
+		if err := db.Where("reset_token = ? AND reset_expires > ?", tokenHash, time.Now()).First(&user).Error; err != nil {
+			c.JSON(400, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+
+		if !checkPasswordPolicy(c, input.Password, user.Name, user.Email) {
+			return
+		}
+
+		hashedPassword, err := auth.HashPassword(input.Password)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to process password"})
+			return
+		}
+
+		// Matching on the token hash makes the token single use even if two
+		// requests race each other
+		result := db.Model(&User{}).
+			Where("id = ? AND reset_token = ?", user.ID, tokenHash).
+			Updates(map[string]interface{}{
+				"password":      hashedPassword,
+				"reset_token":   "",
+				"reset_expires": time.Time{},
+			})
+		if result.Error != nil {
+			c.JSON(500, gin.H{"error": "Failed to reset password"})
+			return
+		}
+		if result.RowsAffected == 0 {
+			c.JSON(400, gin.H{"error": "Invalid or expired reset token"})
+			return
+		}
+
+		// Whoever knew the old password shouldn't stay logged in
+		if err := revokeCredentials(db, user.ID, 0); err != nil {
+			fmt.Println("Error revoking sessions after password reset:", err)
+		}
+		recordSecurityEvent(db, c, EventPasswordReset, user.ID, user.Email, "")
+
+		c.JSON(200, gin.H{"message": "Password reset successfully. You can now log in with your new password."})
+	}
+}
+
+// checkCurrentPassword confirms a logged in user's password before a
+// sensitive change, responding and returning false if it's wrong. Someone
+// with a stolen access token could otherwise guess the password, so failures
+// count towards the same lockout as logins.
+func checkCurrentPassword(c *gin.Context, db *gorm.DB, guard *LoginGuard, mail mailer.Mailer, user *User, password string) bool {
+	wait, err := guard.Check(user.Email, c.ClientIP())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to check login attempts"})
+		return false
+	}
+	if wait > 0 {
+		c.Header("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		c.JSON(429, gin.H{"error": "Too many failed attempts. Please try again later."})
+		return false
+	}
+
+	if ok, _ := auth.CheckPasswordHash(password, user.Password); !ok {
+		loginFailed(c, db, guard, mail, user.Email, user, "wrong current password")
+		c.JSON(400, gin.H{"error": "Current password is incorrect"})
+		return false
+	}
+	if err := guard.RecordSuccess(user.Email); err != nil {
+		fmt.Println("Error clearing login attempts:", err)
+	}
+	return true
+}
+
+func changePassword(db *gorm.DB, mail mailer.Mailer, guard *LoginGuard) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			CurrentPassword string `json:"current_password" binding:"required"`
+			NewPassword     string `json:"new_password" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		userID := getUserIdFromToken(c)
+		var user User
+		if err := db.First(&user, userID).Error; err != nil {
+			c.JSON(404, gin.H{"error": "User not found"})
+			return
+		}
+
+		if !checkCurrentPassword(c, db, guard, mail, &user, input.CurrentPassword) {
+			return
+		}
+		if input.NewPassword == input.CurrentPassword {
+			c.JSON(400, gin.H{"error": "New password must be different from the current one"})
+			return
+		}
+		if !checkPasswordPolicy(c, input.NewPassword, user.Name, user.Email) {
+			return
+		}
+
+		hashedPassword, err := auth.HashPassword(input.NewPassword)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to process password"})
+			return
+		}
+
+		// Any outstanding reset link is for the old password
+		if err := db.Model(&user).Updates(map[string]interface{}{
+			"password":      hashedPassword,
+			"reset_token":   "",
+			"reset_expires": time.Time{},
+		}).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to change password"})
+			return
+		}
+
+		// Keep the session making this request, end everything else
+		if err := revokeCredentials(db, user.ID, c.GetUint("sessionID")); err != nil {
+			c.JSON(500, gin.H{"error": "Password changed but failed to log out other sessions"})
+			return
+		}
+		recordSecurityEvent(db, c, EventPasswordChanged, user.ID, user.Email, "")
+
+		go func(user User, ip string) {
+			if err := mailer.SendTemplate(mail, "password_changed", user.Email, gin.H{
+				"Name": user.Name,
+				"IP":   ip,
+				"When": time.Now().Format("2 Jan 2006 at 15:04 MST"),
+			}); err != nil {
+				fmt.Println("Error sending password changed email:", err)
+			}
+		}(user, c.ClientIP())
+
+		c.JSON(200, gin.H{"message": "Password changed. You have been logged out of all other sessions."})
+	}
+}
@@ -0,0 +1,165 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Permission keys stored in Role.Permissions
+const (
+	PermManageRoles   = "can_manage_roles"
+	PermManageUsers   = "can_manage_users"
+	PermDeleteThreads = "can_delete_threads"
+	PermPinThreads    = "can_pin_threads"
+	PermReply         = "can_reply"
+	PermCreateThreads = "can_create_threads"
+	PermSuspendUsers  = "can_suspend_users"
+)
+
+// PermissionInfo describes a permission key roles can be granted
+type PermissionInfo struct {
+	Key         string `json:"key"`
+	Description string `json:"description"`
+}
+
+// permissionCatalogue lists every permission the server checks. Roles may
+// only be given keys from here so a typo can't silently grant nothing.
+var permissionCatalogue = []PermissionInfo{
+	{PermManageRoles, "Create, edit and delete roles and change users' roles"},
+	{PermManageUsers, "Manage users, registrations, invites and email domains"},
+	{PermDeleteThreads, "Delete other people's threads and replies in sections without rules"},
+	{PermPinThreads, "Pin and unpin threads"},
+	{PermSuspendUsers, "Suspend and ban users"},
+	{PermCreateThreads, "Start new threads"},
+	{PermReply, "Reply to threads"},
+}
+
+func knownPermission(key string) bool {
+	for _, permission := range permissionCatalogue {
+		if permission.Key == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Has reports whether the permission is granted, missing keys count as denied
+func (p Permissions) Has(permission string) bool {
+	return p[permission]
+}
+
+// TwoFactorRequired reports whether members of the role must use 2FA
+func (r Role) TwoFactorRequired() bool {
+	return r.RequireTwoFactor ||
+		r.Permissions.Has(PermManageRoles) ||
+		r.Permissions.Has(PermManageUsers)
+}
+
+// staffPermissions are the permissions over other members and their posts,
+// the ones that decide who may act against whom
+var staffPermissions = []string{
+	PermManageRoles,
+	PermManageUsers,
+	PermSuspendUsers,
+	PermDeleteThreads,
+	PermPinThreads,
+}
+
+// Outranks reports whether members of r may act against members of other:
+// other has no staff permission r lacks, and if other has any at all r has
+// at least one more. So moderators can suspend members but not each other,
+// and admins can suspend moderators but not other admins.
+func (r Role) Outranks(other Role) bool {
+	extra := false
+	for _, permission := range staffPermissions {
+		has, otherHas := r.Permissions.Has(permission), other.Permissions.Has(permission)
+		if otherHas && !has {
+			return false
+		}
+		extra = extra || (has && !otherHas)
+	}
+	return extra || !other.hasStaffPermission()
+}
+
+// IsStaff reports whether the role has any staff permission or needs 2FA.
+// Staff roles are only given through the role change endpoint, which needs
+// can_manage_roles, never handed out by email domain, invite or approval.
+func (r Role) IsStaff() bool {
+	return r.TwoFactorRequired() || r.hasStaffPermission()
+}
+
+func (r Role) hasStaffPermission() bool {
+	for _, permission := range staffPermissions {
+		if r.Permissions.Has(permission) {
+			return true
+		}
+	}
+	return false
+}
+
+// CanPostIn reports whether the user may post in a section. Only invited
+// users are limited to some sections, everyone else may post anywhere.
+func (u User) CanPostIn(section string) bool {
+	if u.AllowedSections == "" {
+		return true
+	}
+	for _, allowed := range strings.Split(u.AllowedSections, ",") {
+		if allowed == strings.ToLower(section) {
+			return true
+		}
+	}
+	return false
+}
+
+// currentUser loads the caller with their role, caching it on the context so
+// it is only fetched once per request. Must run after AuthMiddleware.
+func currentUser(c *gin.Context, db *gorm.DB) (*User, error) {
+	if cached, exists := c.Get("currentUser"); exists {
+		return cached.(*User), nil
+	}
+
+	var user User
+	if err := db.Preload("Role").First(&user, c.GetUint("userID")).Error; err != nil {
+		return nil, err
+	}
+
+	c.Set("currentUser", &user)
+	return &user, nil
+}
+
+// RequirePermission aborts with 403 unless the caller's role grants permission
+func RequirePermission(db *gorm.DB, permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := currentUser(c, db)
+		if err != nil {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Access denied"})
+			c.Abort()
+			return
+		}
+		role := &user.Role
+
+		// Covers users moved into a 2FA role after they logged in
+		if role.TwoFactorRequired() && !user.TOTPEnabled {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":                     "Two factor authentication must be enabled for your role",
+				"two_factor_setup_required": true,
+			})
+			c.Abort()
+			return
+		}
+
+		if !role.Permissions.Has(permission) {
+			c.JSON(http.StatusForbidden, gin.H{
+				"error":      "Insufficient permissions",
+				"permission": permission,
+			})
+			c.Abort()
+			return
+		}
+
+		c.Next()
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import "testing"
+
+func TestRoleOutranks(t *testing.T) {
+	admin := Role{Name: "admin", Permissions: Permissions{
+		PermManageRoles: true, PermManageUsers: true, PermSuspendUsers: true,
+		PermDeleteThreads: true, PermPinThreads: true, PermReply: true, PermCreateThreads: true,
+	}}
+	moderator := Role{Name: "moderator", Permissions: Permissions{
+		PermSuspendUsers: true, PermDeleteThreads: true, PermPinThreads: true, PermReply: true, PermCreateThreads: true,
+	}}
+	member := Role{Name: "member", Permissions: Permissions{PermReply: true, PermCreateThreads: true}}
+	guest := Role{Name: "guest", Permissions: Permissions{}}
+	// Can suspend but not delete posts, so neither outranks a moderator
+	suspender := Role{Name: "suspender", Permissions: Permissions{PermSuspendUsers: true}}
+	pinner := Role{Name: "pinner", Permissions: Permissions{PermPinThreads: true}}
+
+	tests := []struct {
+		actor, target Role
+		want          bool
+	}{
+		{admin, moderator, true},
+		{admin, member, true},
+		{admin, admin, false},
+		{moderator, member, true},
+		{moderator, guest, true},
+		{moderator, moderator, false},
+		{moderator, admin, false},
+		{suspender, moderator, false},
+		{suspender, member, true},
+		{suspender, pinner, false},
+		{member, guest, true},
+	}
+	for _, tt := range tests {
+		if got := tt.actor.Outranks(tt.target); got != tt.want {
+			t.Errorf("%s.Outranks(%s) = %v, want %v", tt.actor.Name, tt.target.Name, got, tt.want)
+		}
+	}
+}
+
+func TestRoleIsStaff(t *testing.T) {
+	tests := []struct {
+		role Role
+		want bool
+	}{
+		{Role{Name: "member", Permissions: Permissions{PermReply: true, PermCreateThreads: true}}, false},
+		{Role{Name: "guest"}, false},
+		{Role{Name: "moderator", Permissions: Permissions{PermSuspendUsers: true, PermDeleteThreads: true}}, true},
+		{Role{Name: "admin", Permissions: Permissions{PermManageRoles: true}}, true},
+		{Role{Name: "treasurer", RequireTwoFactor: true}, true},
+	}
+	for _, tt := range tests {
+		if got := tt.role.IsStaff(); got != tt.want {
+			t.Errorf("%s.IsStaff() = %v, want %v", tt.role.Name, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// RateLimiter allows a fixed number of events per key in a sliding window.
+// State is in memory, which is fine for a single server instance.
+type RateLimiter struct {
+	mu     sync.Mutex
+	limit  int
+	window time.Duration
+	events map[string][]time.Time
+}
+
+func NewRateLimiter(limit int, window time.Duration) *RateLimiter {
+	limiter := &RateLimiter{
+		limit:  limit,
+		window: window,
+		events: make(map[string][]time.Time),
+	}
+	startBackgroundJob("rate limiter cleanup", window, func() error {
+		limiter.prune()
+		return nil
+	})
+	return limiter
+}
+
+// Allow records an event for key and reports whether it is within the limit.
+// When it isn't, the returned duration is how long until the next slot frees.
+func (l *RateLimiter) Allow(key string) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	recent := l.recent(key, now)
+	if len(recent) >= l.limit {
+		l.events[key] = recent
+		return false, recent[0].Add(l.window).Sub(now)
+	}
+
+	l.events[key] = append(recent, now)
+	return true, 0
+}
+
+// recent returns the events for key still inside the window, oldest first
+func (l *RateLimiter) recent(key string, now time.Time) []time.Time {
+	events := l.events[key]
+	cutoff := now.Add(-l.window)
+	i := 0
+	for i < len(events) && !events[i].After(cutoff) {
+		i++
+	}
+	return events[i:]
+}
+
+func (l *RateLimiter) prune() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	for key := range l.events {
+		if recent := l.recent(key, now); len(recent) == 0 {
+			delete(l.events, key)
+		} else {
+			l.events[key] = recent
+		}
+	}
+}
+
+// RateLimitByIP limits requests per client IP with a 429 response
+func RateLimitByIP(limiter *RateLimiter) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		allowed, wait := limiter.Allow(c.ClientIP())
+		if !allowed {
+			retryAfter := int(wait.Seconds()) + 1
+			c.Header("Retry-After", strconv.Itoa(retryAfter))
+			c.JSON(429, gin.H{
+				"error":       "Too many requests. Please try again later.",
+				"retry_after": retryAfter,
+			})
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/stefvuck/forum/internal/mailer"
+)
+
+/*
+
+EMAIL DOMAIN LOGIC
+
+*/
+
+func getEmailDomains(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var domains []EmailDomain
+		if err := db.Preload("Role").Preload("AlumniRole").Order("domain").Find(&domains).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch email domains"})
+			return
+		}
+		c.JSON(http.StatusOK, domains)
+	}
+}
+
+func createEmailDomain(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Domain string      `json:"domain" binding:"required"`
+			RoleID json.Number `json:"roleId" binding:"required"`
+			// Optional, 0 clears it and leaving it out keeps the current one
+			AlumniRoleID *json.Number `json:"alumniRoleId"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+			return
+		}
+
+		domain := normalizeDomain(input.Domain)
+		if domain == "" || strings.ContainsAny(domain, "@ ") || !strings.Contains(domain, ".") {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain"})
+			return
+		}
+
+		roleID, err := input.RoleID.Int64()
+		if err != nil || roleID <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+			return
+		}
+		var role Role
+		if err := db.First(&role, roleID).Error; err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role does not exist"})
+			return
+		}
+		// Otherwise anyone who can manage users could make every new
+		// account from a domain an admin
+		if role.IsStaff() {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Email domains can't grant staff roles"})
+			return
+		}
+
+		updates := map[string]interface{}{"role_id": role.ID}
+		if input.AlumniRoleID != nil {
+			alumniRoleID, err := input.AlumniRoleID.Int64()
+			if err != nil || alumniRoleID < 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid alumni role ID"})
+				return
+			}
+			if alumniRoleID == 0 {
+				updates["alumni_role_id"] = nil
+			} else {
+				var alumniRole Role
+				if err := db.First(&alumniRole, alumniRoleID).Error; err != nil {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Alumni role does not exist"})
+					return
+				}
+				if alumniRole.IsStaff() {
+					c.JSON(http.StatusBadRequest, gin.H{"error": "Email domains can't grant staff roles"})
+					return
+				}
+				updates["alumni_role_id"] = alumniRole.ID
+			}
+		}
+
+		// Adding an existing domain updates its roles
+		var emailDomain EmailDomain
+		var before interface{}
+		err = db.Where("domain = ?", domain).First(&emailDomain).Error
+		switch {
+		case err == nil:
+			before = emailDomain
+			if err := db.Model(&emailDomain).Updates(updates).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update email domain"})
+				return
+			}
+		case errors.Is(err, gorm.ErrRecordNotFound):
+			emailDomain = EmailDomain{Domain: domain, RoleID: role.ID}
+			if id, ok := updates["alumni_role_id"].(uint); ok {
+				emailDomain.AlumniRoleID = &id
+			}
+			if err := db.Create(&emailDomain).Error; err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create email domain"})
+				return
+			}
+		default:
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create email domain"})
+			return
+		}
+
+		db.Preload("Role").Preload("AlumniRole").First(&emailDomain, emailDomain.ID)
+		recordAudit(db, c, AuditEmailDomainSet, AuditTargetEmailDomain, emailDomain.ID, before, emailDomain)
+
+		c.JSON(http.StatusOK, emailDomain)
+	}
+}
+
+func deleteEmailDomain(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id, err := strconv.Atoi(c.Param("id"))
+		if err != nil || id <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid domain ID"})
+			return
+		}
+
+		var emailDomain EmailDomain
+		if err := db.First(&emailDomain, id).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Email domain not found"})
+			return
+		}
+		if err := db.Unscoped().Delete(&emailDomain).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete email domain"})
+			return
+		}
+
+		recordAudit(db, c, AuditEmailDomainDeleted, AuditTargetEmailDomain, emailDomain.ID, emailDomain, nil)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Email domain deleted"})
+	}
+}
+
+/*
+
+APPROVAL QUEUE LOGIC
+
+*/
+
+func getPendingRegistrations(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var users []User
+		if err := db.Preload("Role").
+			Where("approval_status = ?", ApprovalPending).
+			Order("created_at").
+			Find(&users).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch pending registrations"})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"users": users})
+	}
+}
+
+// loadPendingUser fetches the user named in the URL if they are awaiting approval
+func loadPendingUser(c *gin.Context, db *gorm.DB) (*User, bool) {
+	userId, err := strconv.Atoi(c.Param("userId"))
+	if err != nil || userId <= 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	var user User
+	if err := db.Where("approval_status = ?", ApprovalPending).First(&user, userId).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Pending registration not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+func approveRegistration(db *gorm.DB, mail mailer.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := loadPendingUser(c, db)
+		if !ok {
+			return
+		}
+
+		// Optionally assign a different role while approving
+		var input struct {
+			RoleID json.Number `json:"roleId"`
+		}
+		if c.Request.ContentLength > 0 {
+			if err := c.ShouldBindJSON(&input); err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid input"})
+				return
+			}
+		}
+
+		updates := map[string]interface{}{"approval_status": ApprovalApproved}
+		if input.RoleID != "" {
+			roleID, err := input.RoleID.Int64()
+			if err != nil || roleID <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+				return
+			}
+			var role Role
+			if err := db.First(&role, roleID).Error; err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Role does not exist"})
+				return
+			}
+			if role.IsStaff() {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Approval can't grant this role, promote the user after approving them"})
+				return
+			}
+			updates["role_id"] = role.ID
+		}
+
+		before := gin.H{"approval_status": user.ApprovalStatus, "role_id": user.RoleID}
+		if err := db.Model(user).Updates(updates).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to approve registration"})
+			return
+		}
+		recordAudit(db, c, AuditRegistrationApproved, AuditTargetUser, user.ID, before, updates)
+
+		if err := mailer.SendTemplate(mail, "registration_approved", user.Email, gin.H{
+			"Name": user.Name,
+		}); err != nil {
+			fmt.Println("Error sending approval email:", err)
+		}
+
+		db.Preload("Role").First(user, user.ID)
+		c.JSON(http.StatusOK, gin.H{
+			"message": "Registration approved",
+			"user":    user,
+		})
+	}
+}
+
+func rejectRegistration(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, ok := loadPendingUser(c, db)
+		if !ok {
+			return
+		}
+
+		// Hard delete so the address can register again later
+		if err := db.Unscoped().Delete(user).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to reject registration"})
+			return
+		}
+		recordAudit(db, c, AuditRegistrationRejected, AuditTargetUser, user.ID,
+			gin.H{"approval_status": user.ApprovalStatus, "role_id": user.RoleID}, nil)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Registration rejected"})
+	}
+}
@@ -34,10 +34,27 @@ func createReply(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Get user ID from token
-		userID := getUserIdFromToken(c) // Assuming this function extracts the user ID from the token
+		user, err := currentUser(c, db)
+		if err != nil {
+			c.JSON(401, gin.H{"error": "Unauthorized"})
+			return
+		}
+		access, err := sectionAccess(c, db)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check section access"})
+			return
+		}
+		if !access.CanRead(thread.Section) {
+			c.JSON(404, gin.H{"error": "Thread not found"})
+			return
+		}
+		if !access.CanPost(thread.Section) {
+			c.JSON(403, gin.H{"error": "You can't post in this section"})
+			return
+		}
+
 		reply.ThreadID = threadID
-		reply.UserID = userID // Use the user ID from the token
+		reply.UserID = user.ID
 
 		if err := db.Create(&reply).Error; err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
@@ -57,6 +74,21 @@ func getReplies(db *gorm.DB) gin.HandlerFunc {
 		var replies []Reply
 		threadId := c.Param("id")
 
+		var thread Thread
+		if err := db.First(&thread, threadId).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Thread not found"})
+			return
+		}
+		access, err := sectionAccess(c, db)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check section access"})
+			return
+		}
+		if !access.CanRead(thread.Section) {
+			c.JSON(404, gin.H{"error": "Thread not found"})
+			return
+		}
+
 		if err := db.Where("thread_id = ?", threadId).Find(&replies).Error; err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
 			return
@@ -65,3 +97,49 @@ func getReplies(db *gorm.DB) gin.HandlerFunc {
 		c.JSON(200, replies)
 	}
 }
+
+// Delete a reply. Authors can delete their own, anyone else needs to
+// moderate the thread's section.
+func deleteReply(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var reply Reply
+		if err := db.Preload("Thread").
+			Where("thread_id = ?", c.Param("id")).
+			First(&reply, c.Param("replyId")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Reply not found"})
+			return
+		}
+
+		user, err := currentUser(c, db)
+		if err != nil {
+			c.JSON(401, gin.H{"error": "Unauthorized"})
+			return
+		}
+		access, err := sectionAccess(c, db)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check section access"})
+			return
+		}
+		if !access.CanRead(reply.Thread.Section) {
+			c.JSON(404, gin.H{"error": "Reply not found"})
+			return
+		}
+		moderating := reply.UserID != user.ID
+		if moderating && !access.CanModerate(reply.Thread.Section) {
+			c.JSON(403, gin.H{"error": "You can't moderate this section"})
+			return
+		}
+
+		if err := db.Delete(&reply).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to delete reply"})
+			return
+		}
+
+		if moderating {
+			recordAudit(db, c, AuditReplyDeleted, AuditTargetReply, reply.ID,
+				gin.H{"thread_id": reply.ThreadID, "section": reply.Thread.Section, "user_id": reply.UserID}, nil)
+		}
+
+		c.JSON(200, gin.H{"message": "Reply deleted"})
+	}
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+var (
+	roleNamePattern  = regexp.MustCompile(`^[a-z][a-z0-9_]{1,31}$`)
+	roleColorPattern = regexp.MustCompile(`^#[0-9A-Fa-f]{6}$`)
+)
+
+var errLastRoleManager = errors.New("no role would be left that can manage roles")
+
+type roleInput struct {
+	Name             *string     `json:"name"`
+	Color            *string     `json:"color"`
+	Permissions      Permissions `json:"permissions"`
+	RequireTwoFactor *bool       `json:"require_two_factor"`
+}
+
+// validate checks the fields that were sent, responding and returning false
+// if any are invalid
+func (input *roleInput) validate(c *gin.Context) bool {
+	if input.Name != nil {
+		*input.Name = strings.ToLower(strings.TrimSpace(*input.Name))
+		if !roleNamePattern.MatchString(*input.Name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Role name must be 2 to 32 lowercase letters, digits or underscores, starting with a letter"})
+			return false
+		}
+	}
+
+	if input.Color != nil && !roleColorPattern.MatchString(*input.Color) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Color must be a hex color like #4444FF"})
+		return false
+	}
+
+	var unknown []string
+	for key := range input.Permissions {
+		if !knownPermission(key) {
+			unknown = append(unknown, key)
+		}
+	}
+	if len(unknown) > 0 {
+		sort.Strings(unknown)
+		c.JSON(http.StatusBadRequest, gin.H{
+			"error":               "Unknown permissions",
+			"unknown_permissions": unknown,
+		})
+		return false
+	}
+	return true
+}
+
+func loadRole(c *gin.Context, db *gorm.DB) (*Role, bool) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+		return nil, false
+	}
+
+	var role Role
+	if err := db.First(&role, id).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "Role not found"})
+		return nil, false
+	}
+	return &role, true
+}
+
+// roleNameTaken also checks soft deleted roles, whose names the unique
+// index still holds
+func roleNameTaken(db *gorm.DB, name string, exceptID uint) (bool, error) {
+	var count int64
+	err := db.Unscoped().Model(&Role{}).Where("name = ? AND id <> ?", name, exceptID).Count(&count).Error
+	return count > 0, err
+}
+
+// checkRoleManagers makes sure some role other than roleID can still manage
+// roles, so admins can't lock everyone out of this page
+func checkRoleManagers(tx *gorm.DB, roleID uint) error {
+	var count int64
+	if err := tx.Model(&Role{}).
+		Where("id <> ? AND (permissions->>?)::boolean", roleID, PermManageRoles).
+		Count(&count).Error; err != nil {
+		return err
+	}
+	if count == 0 {
+		return errLastRoleManager
+	}
+	return nil
+}
+
+func getPermissionCatalogue() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		c.JSON(http.StatusOK, permissionCatalogue)
+	}
+}
+
+func createRole(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input roleInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if input.Name == nil || input.Color == nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Name and color are required"})
+			return
+		}
+		if !input.validate(c) {
+			return
+		}
+
+		taken, err := roleNameTaken(db, *input.Name, 0)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check role name"})
+			return
+		}
+		if taken {
+			c.JSON(http.StatusConflict, gin.H{"error": "A role with this name already exists"})
+			return
+		}
+
+		role := Role{
+			Name:        *input.Name,
+			Color:       strings.ToUpper(*input.Color),
+			Permissions: input.Permissions,
+		}
+		if role.Permissions == nil {
+			role.Permissions = make(Permissions)
+		}
+		if input.RequireTwoFactor != nil {
+			role.RequireTwoFactor = *input.RequireTwoFactor
+		}
+
+		if err := db.Create(&role).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create role"})
+			return
+		}
+
+		recordAudit(db, c, AuditRoleCreated, AuditTargetRole, role.ID, nil, role)
+
+		c.JSON(http.StatusCreated, role)
+	}
+}
+
+// updateRole changes only the fields that are sent. Permissions sent are
+// merged into the role's, set a key to false to take it away.
+func updateRole(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, ok := loadRole(c, db)
+		if !ok {
+			return
+		}
+
+		var input roleInput
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !input.validate(c) {
+			return
+		}
+
+		// Copied before the permissions map is changed in place
+		before := *role
+		before.Permissions = make(Permissions, len(role.Permissions))
+		for key, value := range role.Permissions {
+			before.Permissions[key] = value
+		}
+
+		if input.Name != nil && *input.Name != role.Name {
+			if isDefaultRole(role.Name) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Built in roles can't be renamed"})
+				return
+			}
+			taken, err := roleNameTaken(db, *input.Name, role.ID)
+			if err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check role name"})
+				return
+			}
+			if taken {
+				c.JSON(http.StatusConflict, gin.H{"error": "A role with this name already exists"})
+				return
+			}
+			role.Name = *input.Name
+		}
+		if input.Color != nil {
+			role.Color = strings.ToUpper(*input.Color)
+		}
+		if input.RequireTwoFactor != nil {
+			role.RequireTwoFactor = *input.RequireTwoFactor
+		}
+
+		hadManageRoles := role.Permissions.Has(PermManageRoles)
+		if role.Permissions == nil {
+			role.Permissions = make(Permissions)
+		}
+		for key, value := range input.Permissions {
+			role.Permissions[key] = value
+		}
+
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if hadManageRoles && !role.Permissions.Has(PermManageRoles) {
+				if err := checkRoleManagers(tx, role.ID); err != nil {
+					return err
+				}
+			}
+			return tx.Model(role).Select("name", "color", "permissions", "require_two_factor").Updates(role).Error
+		})
+		if errors.Is(err, errLastRoleManager) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one role must be able to manage roles"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update role"})
+			return
+		}
+
+		recordAudit(db, c, AuditRoleUpdated, AuditTargetRole, role.ID, before, role)
+
+		c.JSON(http.StatusOK, role)
+	}
+}
+
+// deleteRole refuses to delete a role that is still in use unless
+// ?reassign_to=<role id> is given, in which case its users, email domains,
+// invites and section rules are moved to that role first
+func deleteRole(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		role, ok := loadRole(c, db)
+		if !ok {
+			return
+		}
+		if isDefaultRole(role.Name) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Built in roles can't be deleted"})
+			return
+		}
+
+		var target *Role
+		if reassignTo := c.Query("reassign_to"); reassignTo != "" {
+			id, err := strconv.ParseUint(reassignTo, 10, 32)
+			if err != nil || uint(id) == role.ID {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid reassign_to role"})
+				return
+			}
+			target = &Role{}
+			if err := db.First(target, id).Error; err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Role to reassign to does not exist"})
+				return
+			}
+		}
+
+		// Everything that points at a role by ID
+		references := []struct {
+			model  interface{}
+			column string
+		}{
+			{&User{}, "role_id"},
+			{&EmailDomain{}, "role_id"},
+			{&EmailDomain{}, "alumni_role_id"},
+			{&Invite{}, "role_id"},
+			{&SectionRule{}, "role_id"},
+		}
+
+		var assigned int64
+		err := db.Transaction(func(tx *gorm.DB) error {
+			if role.Permissions.Has(PermManageRoles) {
+				if err := checkRoleManagers(tx, role.ID); err != nil {
+					return err
+				}
+			}
+
+			for _, ref := range references {
+				if target == nil {
+					var count int64
+					if err := tx.Model(ref.model).Where(ref.column+" = ?", role.ID).Count(&count).Error; err != nil {
+						return err
+					}
+					assigned += count
+					continue
+				}
+				if err := tx.Model(ref.model).Where(ref.column+" = ?", role.ID).Update(ref.column, target.ID).Error; err != nil {
+					return err
+				}
+			}
+			if assigned > 0 {
+				return nil
+			}
+			return tx.Delete(role).Error
+		})
+		if errors.Is(err, errLastRoleManager) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "At least one role must be able to manage roles"})
+			return
+		}
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete role"})
+			return
+		}
+		if assigned > 0 {
+			c.JSON(http.StatusConflict, gin.H{
+				"error":    fmt.Sprintf("Role is still in use by %d users, email domains, invites or section rules, choose a role to reassign them to", assigned),
+				"assigned": assigned,
+			})
+			return
+		}
+
+		var after interface{}
+		if target != nil {
+			after = gin.H{"reassigned_to": target.ID}
+		}
+		recordAudit(db, c, AuditRoleDeleted, AuditTargetRole, role.ID, role, after)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Role deleted"})
+	}
+}
@@ -15,6 +15,12 @@ func handleSearch(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		access, err := sectionAccess(c, db)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check section access"})
+			return
+		}
+
 		// Main query with correct column selection
 		query := db.Model(&Thread{}).
 			Select(`
@@ -48,6 +54,10 @@ func handleSearch(db *gorm.DB) gin.HandlerFunc {
 			query = query.Where("LOWER(threads.tags) LIKE LOWER(?)", "%"+params.Query+"%")
 		}
 
+		// Never return threads from sections the user can't see
+		hiddenFilter, hiddenArgs := hiddenSectionsFilter("threads.section", access.HiddenSections())
+		query = query.Where(hiddenFilter, hiddenArgs...)
+
 		// Section filter
 		if params.Section != "" && params.Section != "all" {
 			query = query.Where("threads.section = ?", params.Section)
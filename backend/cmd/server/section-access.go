@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// sectionGrant is what the rules matching a user allow in one section
+type sectionGrant struct {
+	Read     bool `json:"can_read"`
+	Post     bool `json:"can_post"`
+	Moderate bool `json:"can_moderate"`
+}
+
+// SectionAccess is what one user may do in each section, worked out from
+// the section rules, their role and any sections an invite limited them to
+type SectionAccess struct {
+	user       *User
+	restricted map[string]bool // sections that have at least one rule
+	grants     map[string]sectionGrant
+}
+
+func normaliseSection(section string) string {
+	return strings.ToLower(strings.TrimSpace(section))
+}
+
+// seedSectionRules gives the roles from config full access to their section,
+// for sections that have never had rules. Sections whose rules were edited
+// or removed through the admin API are left alone.
+func seedSectionRules(db *gorm.DB, sections map[string]string) error {
+	for section, roleNames := range sections {
+		section = normaliseSection(section)
+
+		var count int64
+		if err := db.Unscoped().Model(&SectionRule{}).Where("section = ?", section).Count(&count).Error; err != nil {
+			return err
+		}
+		if count > 0 {
+			continue
+		}
+
+		for _, roleName := range strings.Split(roleNames, "+") {
+			var role Role
+			if err := db.Where("name = ?", strings.TrimSpace(roleName)).First(&role).Error; err != nil {
+				fmt.Printf("Skipping %s section rule: role %q not found\n", section, roleName)
+				continue
+			}
+
+			rule := SectionRule{Section: section, RoleID: &role.ID, CanRead: true, CanPost: true, CanModerate: true}
+			if err := db.Create(&rule).Error; err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// normaliseThreadSections fixes threads saved before createThread normalised
+// the section, which section listings and rule checks wouldn't match
+func normaliseThreadSections(db *gorm.DB) error {
+	return db.Exec(`
+        UPDATE threads
+        SET section = LOWER(TRIM(section))
+        WHERE section <> LOWER(TRIM(section))
+    `).Error
+}
+
+// NewSectionAccess loads the rules that apply to user
+func NewSectionAccess(db *gorm.DB, user *User) (*SectionAccess, error) {
+	var rules []SectionRule
+	if err := db.Find(&rules).Error; err != nil {
+		return nil, err
+	}
+	return newSectionAccess(rules, user), nil
+}
+
+func newSectionAccess(rules []SectionRule, user *User) *SectionAccess {
+	access := &SectionAccess{
+		user:       user,
+		restricted: make(map[string]bool),
+		grants:     make(map[string]sectionGrant),
+	}
+	for _, rule := range rules {
+		access.restricted[rule.Section] = true
+
+		matches := (rule.RoleID != nil && *rule.RoleID == user.RoleID) ||
+			(rule.UserID != nil && *rule.UserID == user.ID)
+		if !matches {
+			continue
+		}
+
+		grant := access.grants[rule.Section]
+		grant.Moderate = grant.Moderate || rule.CanModerate
+		grant.Post = grant.Post || rule.CanPost || rule.CanModerate
+		grant.Read = grant.Read || rule.CanRead || rule.CanPost || rule.CanModerate
+		access.grants[rule.Section] = grant
+	}
+	return access
+}
+
+// sectionAccess loads the caller's section access, caching it on the context
+// like currentUser. Must run after AuthMiddleware.
+func sectionAccess(c *gin.Context, db *gorm.DB) (*SectionAccess, error) {
+	if cached, exists := c.Get("sectionAccess"); exists {
+		return cached.(*SectionAccess), nil
+	}
+
+	user, err := currentUser(c, db)
+	if err != nil {
+		return nil, err
+	}
+	access, err := NewSectionAccess(db, user)
+	if err != nil {
+		return nil, err
+	}
+
+	c.Set("sectionAccess", access)
+	return access, nil
+}
+
+func (a *SectionAccess) CanRead(section string) bool {
+	section = normaliseSection(section)
+	return !a.restricted[section] || a.grants[section].Read
+}
+
+// CanPost also needs the role's can_create_threads or can_reply, which
+// RequirePermission checks on the route
+func (a *SectionAccess) CanPost(section string) bool {
+	section = normaliseSection(section)
+	if !a.user.CanPostIn(section) {
+		return false
+	}
+	return !a.restricted[section] || a.grants[section].Post
+}
+
+// CanModerate is whether the user may delete other people's threads and
+// replies in section. Open sections fall back to the role's can_delete_threads.
+func (a *SectionAccess) CanModerate(section string) bool {
+	section = normaliseSection(section)
+	if a.restricted[section] {
+		return a.grants[section].Moderate
+	}
+	return a.user.Role.Permissions.Has(PermDeleteThreads)
+}
+
+// HiddenSections lists the sections the user can't read, for filtering
+// queries that span sections
+func (a *SectionAccess) HiddenSections() []string {
+	var hidden []string
+	for section := range a.restricted {
+		if !a.grants[section].Read {
+			hidden = append(hidden, section)
+		}
+	}
+	sort.Strings(hidden)
+	return hidden
+}
+
+// Restricted lists the sections that have rules, with what the user may do
+// in each
+func (a *SectionAccess) Restricted() map[string]sectionGrant {
+	restricted := make(map[string]sectionGrant, len(a.restricted))
+	for section := range a.restricted {
+		restricted[section] = a.grants[section]
+	}
+	return restricted
+}
+
+// hiddenSectionsFilter returns a condition excluding threads whose section
+// column is one of hidden, and its arguments. The column is compared the way
+// normaliseSection would store it, so "Team " is hidden along with "team".
+// Just TRUE when nothing is hidden, since NOT IN () isn't valid SQL.
+func hiddenSectionsFilter(column string, hidden []string) (string, []interface{}) {
+	if len(hidden) == 0 {
+		return "TRUE", nil
+	}
+	return "LOWER(TRIM(COALESCE(" + column + ", ''))) NOT IN ?", []interface{}{hidden}
+}
@@ -0,0 +1,93 @@
+package main
+
+import "testing"
+
+func testSectionAccess(permissions Permissions, grants map[string]sectionGrant) *SectionAccess {
+	access := &SectionAccess{
+		user:       &User{Role: Role{Permissions: permissions}},
+		restricted: make(map[string]bool),
+		grants:     grants,
+	}
+	for section := range grants {
+		access.restricted[section] = true
+	}
+	return access
+}
+
+func TestSectionAccessCanModerate(t *testing.T) {
+	tests := []struct {
+		name        string
+		permissions Permissions
+		grants      map[string]sectionGrant
+		section     string
+		want        bool
+	}{
+		{"open section, member", Permissions{PermReply: true}, nil, "general", false},
+		{"open section, delete permission", Permissions{PermDeleteThreads: true}, nil, "General", true},
+		{"open section, pin only", Permissions{PermPinThreads: true}, nil, "general", false},
+		{"restricted, moderate rule", nil, map[string]sectionGrant{"team": {Read: true, Post: true, Moderate: true}}, "team", true},
+		{"restricted, post rule", nil, map[string]sectionGrant{"team": {Read: true, Post: true}}, "team", false},
+		// The role permission doesn't reach into sections with rules
+		{"restricted, delete permission", Permissions{PermDeleteThreads: true}, map[string]sectionGrant{"team": {}}, "team", false},
+	}
+	for _, tt := range tests {
+		access := testSectionAccess(tt.permissions, tt.grants)
+		if got := access.CanModerate(tt.section); got != tt.want {
+			t.Errorf("%s: CanModerate(%q) = %v, want %v", tt.name, tt.section, got, tt.want)
+		}
+	}
+}
+
+func TestSectionAccessHiddenSections(t *testing.T) {
+	access := testSectionAccess(nil, map[string]sectionGrant{
+		"team":    {},
+		"alumni":  {},
+		"mentors": {Read: true},
+	})
+	hidden := access.HiddenSections()
+	if len(hidden) != 2 || hidden[0] != "alumni" || hidden[1] != "team" {
+		t.Errorf("HiddenSections() = %v, want [alumni team]", hidden)
+	}
+	if access.CanRead("Team") || !access.CanRead("mentors") || !access.CanRead("general") {
+		t.Error("CanRead disagrees with the grants")
+	}
+}
+
+// anonymiseUser keeps a deleted user's rules with every grant turned off, a
+// section whose only rules were theirs has to stay hidden
+func TestSectionAccessRuleGrantingNothingKeepsSectionHidden(t *testing.T) {
+	deletedUserID := uint(7)
+	rules := []SectionRule{
+		{Section: "mentors", UserID: &deletedUserID},
+	}
+
+	other := &User{Role: Role{Permissions: Permissions{PermDeleteThreads: true}}}
+	other.ID = 8
+	access := newSectionAccess(rules, other)
+	if access.CanRead("mentors") || access.CanModerate("mentors") {
+		t.Error("section with only a disabled rule is open to other users")
+	}
+	if hidden := access.HiddenSections(); len(hidden) != 1 || hidden[0] != "mentors" {
+		t.Errorf("HiddenSections() = %v, want [mentors]", hidden)
+	}
+
+	deleted := &User{}
+	deleted.ID = deletedUserID
+	if newSectionAccess(rules, deleted).CanRead("mentors") {
+		t.Error("disabled rule still grants its user access")
+	}
+}
+
+func TestHiddenSectionsFilter(t *testing.T) {
+	if query, args := hiddenSectionsFilter("threads.section", nil); query != "TRUE" || args != nil {
+		t.Errorf("nothing hidden = %q %v, want TRUE", query, args)
+	}
+
+	query, args := hiddenSectionsFilter("threads.section", []string{"team"})
+	if query != "LOWER(TRIM(COALESCE(threads.section, ''))) NOT IN ?" {
+		t.Errorf("query = %q, want the column trimmed and lowercased", query)
+	}
+	if len(args) != 1 {
+		t.Errorf("args = %v, want the hidden sections", args)
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// getMySectionAccess tells the frontend which sections to hide and where the
+// user can post
+func getMySectionAccess(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		access, err := sectionAccess(c, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check section access"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"restricted": access.Restricted(),
+			"hidden":     access.HiddenSections(),
+		})
+	}
+}
+
+func getSectionRules(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Preload("Role").Preload("User").Order("section, id")
+		if section := c.Query("section"); section != "" {
+			query = query.Where("section = ?", normaliseSection(section))
+		}
+
+		var rules []SectionRule
+		if err := query.Find(&rules).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch section rules"})
+			return
+		}
+		c.JSON(http.StatusOK, rules)
+	}
+}
+
+// setSectionRule creates the rule for a section and a role or user, or
+// replaces the existing one
+func setSectionRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Section     string       `json:"section" binding:"required,max=50"`
+			RoleID      *json.Number `json:"roleId"`
+			UserID      *json.Number `json:"userId"`
+			CanRead     bool         `json:"can_read"`
+			CanPost     bool         `json:"can_post"`
+			CanModerate bool         `json:"can_moderate"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		section := normaliseSection(input.Section)
+		if section == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Section is required"})
+			return
+		}
+		if (input.RoleID == nil) == (input.UserID == nil) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Give either a roleId or a userId"})
+			return
+		}
+
+		rule := SectionRule{Section: section}
+		query := db.Where("section = ?", section)
+		if input.RoleID != nil {
+			roleID, err := input.RoleID.Int64()
+			if err != nil || roleID <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid role ID"})
+				return
+			}
+			var role Role
+			if err := db.First(&role, roleID).Error; err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Role does not exist"})
+				return
+			}
+			rule.RoleID = &role.ID
+			query = query.Where("role_id = ?", role.ID)
+		} else {
+			userID, err := input.UserID.Int64()
+			if err != nil || userID <= 0 {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+				return
+			}
+			var user User
+			if err := db.First(&user, userID).Error; err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "User does not exist"})
+				return
+			}
+			rule.UserID = &user.ID
+			query = query.Where("user_id = ?", user.ID)
+		}
+
+		// A rule granting nothing still counts, it keeps the section restricted
+		// to the roles and users named by its other rules
+		if err := query.FirstOrInit(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save section rule"})
+			return
+		}
+		var before interface{}
+		if rule.ID != 0 {
+			before = rule
+		}
+		rule.CanRead = input.CanRead
+		rule.CanPost = input.CanPost
+		rule.CanModerate = input.CanModerate
+
+		status := http.StatusOK
+		if rule.ID == 0 {
+			status = http.StatusCreated
+		}
+		if err := db.Save(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save section rule"})
+			return
+		}
+
+		recordAudit(db, c, AuditSectionRuleSet, AuditTargetSectionRule, rule.ID, before, rule)
+
+		db.Preload("Role").Preload("User").First(&rule, rule.ID)
+		c.JSON(status, rule)
+	}
+}
+
+// deleteSectionRule removes a rule. Removing a section's last rule opens it
+// to everyone.
+func deleteSectionRule(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		ruleID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid rule ID"})
+			return
+		}
+
+		var rule SectionRule
+		if err := db.First(&rule, ruleID).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "Section rule not found"})
+			return
+		}
+		if err := db.Delete(&rule).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to delete section rule"})
+			return
+		}
+
+		recordAudit(db, c, AuditSectionRuleDeleted, AuditTargetSectionRule, rule.ID, rule, nil)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Section rule deleted"})
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Security event types
+const (
+	EventLoginSuccess    = "login_success"
+	EventLoginFailure    = "login_failure"
+	EventTokenRefresh    = "token_refresh"
+	EventPasswordChanged = "password_changed"
+	EventPasswordReset   = "password_reset"
+	EventEmailChanged    = "email_changed"
+	EventRoleChanged     = "role_changed"
+)
+
+var securityEventTypes = map[string]bool{
+	EventLoginSuccess:    true,
+	EventLoginFailure:    true,
+	EventTokenRefresh:    true,
+	EventPasswordChanged: true,
+	EventPasswordReset:   true,
+	EventEmailChanged:    true,
+	EventRoleChanged:     true,
+}
+
+// recordSecurityEvent logs an event with the request's IP and user agent.
+// Failing to log never fails the request itself.
+func recordSecurityEvent(db *gorm.DB, c *gin.Context, eventType string, userID uint, email, details string) {
+	event := SecurityEvent{
+		UserID:    userID,
+		Email:     email,
+		Type:      eventType,
+		Details:   details,
+		IP:        c.ClientIP(),
+		UserAgent: c.Request.UserAgent(),
+	}
+	if err := db.Create(&event).Error; err != nil {
+		fmt.Println("Error recording security event:", err)
+	}
+}
+
+// pruneSecurityEvents deletes events older than cutoff
+func pruneSecurityEvents(db *gorm.DB, cutoff time.Time) (int64, error) {
+	result := db.Where("created_at < ?", cutoff).Delete(&SecurityEvent{})
+	return result.RowsAffected, result.Error
+}
+
+func startSecurityEventPruning(db *gorm.DB, retention time.Duration) {
+	startBackgroundJob("security event pruning", time.Hour, func() error {
+		pruned, err := pruneSecurityEvents(db, time.Now().Add(-retention))
+		if pruned > 0 {
+			fmt.Printf("Pruned %d security events\n", pruned)
+		}
+		return err
+	})
+}
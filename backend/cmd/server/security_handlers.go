@@ -0,0 +1,88 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// listSecurityEvents writes a page of events matching query, newest first
+func listSecurityEvents(c *gin.Context, query *gorm.DB) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "20"))
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 || pageSize > 100 {
+		pageSize = 20
+	}
+
+	var total int64
+	if err := query.Session(&gorm.Session{}).Model(&SecurityEvent{}).Count(&total).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to count security events"})
+		return
+	}
+
+	var events []SecurityEvent
+	if err := query.Session(&gorm.Session{}).
+		Order("created_at DESC, id DESC").
+		Offset((page - 1) * pageSize).
+		Limit(pageSize).
+		Find(&events).Error; err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch security events"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"events": events,
+		"pagination": gin.H{
+			"page":      page,
+			"page_size": pageSize,
+			"total":     total,
+		},
+	})
+}
+
+func getSecurityEvents(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		userID := getUserIdFromToken(c)
+		if userID == 0 {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+
+		listSecurityEvents(c, db.Where("user_id = ?", userID))
+	}
+}
+
+// getAllSecurityEvents lets admins search every account's events, filtered
+// by user_id, email and type
+func getAllSecurityEvents(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		query := db.Model(&SecurityEvent{})
+
+		if value := c.Query("user_id"); value != "" {
+			userID, err := strconv.ParseUint(value, 10, 32)
+			if err != nil {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+				return
+			}
+			query = query.Where("user_id = ?", userID)
+		}
+		if email := strings.TrimSpace(c.Query("email")); email != "" {
+			query = query.Where("LOWER(email) = ?", strings.ToLower(email))
+		}
+		if eventType := c.Query("type"); eventType != "" {
+			if !securityEventTypes[eventType] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown event type: " + eventType})
+				return
+			}
+			query = query.Where("type = ?", eventType)
+		}
+
+		listSecurityEvents(c, query)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"errors"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/stefvuck/forum/internal/auth"
+)
+
+const refreshTokenLifetime = 30 * 24 * time.Hour
+
+// How long the token a session was just rotated from is tolerated. Requests
+// started before a refresh finished still carry it, and shouldn't be taken
+// for a stolen token.
+const refreshReuseGrace = 30 * time.Second
+
+// How often LastSeenAt is written, so every request doesn't cause an UPDATE
+const sessionTouchInterval = time.Minute
+
+var (
+	ErrSessionNotFound = errors.New("session not found")
+	ErrSessionRevoked  = errors.New("session revoked")
+	ErrSessionExpired  = errors.New("session expired")
+	ErrSessionRotated  = errors.New("session was just refreshed")
+)
+
+type SessionService struct {
+	db *gorm.DB
+}
+
+func NewSessionService(db *gorm.DB) *SessionService {
+	return &SessionService{db: db}
+}
+
+// CreateSession starts a new session for a device and returns it along with
+// the plaintext refresh token. Only the hash of the token is stored.
+func (s *SessionService) CreateSession(userID uint, userAgent, ip string) (*Session, string, error) {
+	refreshToken, err := auth.GenerateRandomToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	session := &Session{
+		UserID:       userID,
+		RefreshToken: auth.HashToken(refreshToken),
+		UserAgent:    userAgent,
+		IP:           ip,
+		LastSeenAt:   now,
+		ExpiresAt:    now.Add(refreshTokenLifetime),
+	}
+	if err := s.db.Create(session).Error; err != nil {
+		return nil, "", err
+	}
+
+	return session, refreshToken, nil
+}
+
+// Rotate exchanges a refresh token for a new one. Presenting a token that was
+// already rotated means it has been copied, so the whole session is revoked,
+// unless it's the one rotated within refreshReuseGrace: that's a parallel
+// request losing the race, which gets ErrSessionRotated and should pick up
+// the new token.
+func (s *SessionService) Rotate(refreshToken, userAgent, ip string) (*Session, string, error) {
+	tokenHash := auth.HashToken(refreshToken)
+
+	var session Session
+	if err := s.db.Where("refresh_token = ?", tokenHash).First(&session).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			// Check for reuse of an old token
+			if err := s.db.Where("previous_token = ?", tokenHash).First(&session).Error; err == nil {
+				if session.RevokedAt == nil && session.RotatedAt != nil && time.Since(*session.RotatedAt) < refreshReuseGrace {
+					return nil, "", ErrSessionRotated
+				}
+				s.Revoke(session.ID, session.UserID)
+				return nil, "", ErrSessionRevoked
+			}
+			return nil, "", ErrSessionNotFound
+		}
+		return nil, "", err
+	}
+
+	if session.RevokedAt != nil {
+		return nil, "", ErrSessionRevoked
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return nil, "", ErrSessionExpired
+	}
+
+	newToken, err := auth.GenerateRandomToken()
+	if err != nil {
+		return nil, "", err
+	}
+
+	now := time.Now()
+	result := s.db.Model(&Session{}).
+		Where("id = ? AND refresh_token = ?", session.ID, tokenHash).
+		Updates(map[string]interface{}{
+			"refresh_token":  auth.HashToken(newToken),
+			"previous_token": tokenHash,
+			"rotated_at":     now,
+			"user_agent":     userAgent,
+			"ip":             ip,
+			"last_seen_at":   now,
+			"expires_at":     now.Add(refreshTokenLifetime),
+		})
+	if result.Error != nil {
+		return nil, "", result.Error
+	}
+	if result.RowsAffected == 0 {
+		// Another request rotated this token first
+		return nil, "", ErrSessionRevoked
+	}
+
+	if err := s.db.First(&session, session.ID).Error; err != nil {
+		return nil, "", err
+	}
+	return &session, newToken, nil
+}
+
+// Validate checks that a session is still usable and records activity on it
+func (s *SessionService) Validate(sessionID, userID uint) error {
+	var session Session
+	if err := s.db.Where("id = ? AND user_id = ?", sessionID, userID).First(&session).Error; err != nil {
+		return ErrSessionNotFound
+	}
+	if session.RevokedAt != nil {
+		return ErrSessionRevoked
+	}
+	if time.Now().After(session.ExpiresAt) {
+		return ErrSessionExpired
+	}
+
+	if time.Since(session.LastSeenAt) > sessionTouchInterval {
+		s.db.Model(&session).Update("last_seen_at", time.Now())
+	}
+	return nil
+}
+
+// ListActive returns the user's sessions that have not been revoked or expired
+func (s *SessionService) ListActive(userID uint) ([]Session, error) {
+	var sessions []Session
+	err := s.db.Where("user_id = ? AND revoked_at IS NULL AND expires_at > ?", userID, time.Now()).
+		Order("last_seen_at desc").
+		Find(&sessions).Error
+	return sessions, err
+}
+
+// Revoke ends a single session belonging to userID
+func (s *SessionService) Revoke(sessionID, userID uint) error {
+	result := s.db.Model(&Session{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", sessionID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ErrSessionNotFound
+	}
+	return nil
+}
+
+// RevokeAll ends every session of the user except keepSessionID (0 keeps none)
+func (s *SessionService) RevokeAll(userID, keepSessionID uint) error {
+	return s.db.Model(&Session{}).
+		Where("user_id = ? AND id <> ? AND revoked_at IS NULL", userID, keepSessionID).
+		Update("revoked_at", time.Now()).Error
+}
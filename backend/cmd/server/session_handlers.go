@@ -0,0 +1,190 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/stefvuck/forum/internal/auth"
+)
+
+// issueTokens returns the login/refresh payload for a session
+func issueTokens(user User, session *Session, refreshToken string) (gin.H, error) {
+	accessToken, err := auth.GenerateToken(user.ID, user.Email, session.ID)
+	if err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"token":         accessToken,
+		"refresh_token": refreshToken,
+		"expires_in":    int(auth.AccessTokenLifetime.Seconds()),
+	}, nil
+}
+
+// completeLogin starts a session for a fully authenticated user and writes
+// the login response, merged with any extra fields
+func completeLogin(c *gin.Context, sessionService *SessionService, user User, extra gin.H) {
+	session, refreshToken, err := sessionService.CreateSession(user.ID, c.Request.UserAgent(), c.ClientIP())
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to create session"})
+		return
+	}
+
+	response, err := issueTokens(user, session, refreshToken)
+	if err != nil {
+		c.JSON(500, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	for key, value := range extra {
+		response[key] = value
+	}
+	response["user"] = gin.H{
+		"id":    user.ID,
+		"email": user.Email,
+		"name":  user.Name,
+		"role":  user.Role,
+	}
+
+	if err := writeAuthCookies(c, response); err != nil {
+		c.JSON(500, gin.H{"error": "Failed to generate token"})
+		return
+	}
+
+	recordSecurityEvent(sessionService.db, c, EventLoginSuccess, user.ID, user.Email, "")
+	c.JSON(200, response)
+}
+
+func handleRefreshToken(db *gorm.DB) gin.HandlerFunc {
+	sessionService := NewSessionService(db)
+
+	return func(c *gin.Context) {
+		var input struct {
+			RefreshToken string `json:"refresh_token"`
+		}
+
+		// Cookie mode clients send no body
+		if err := c.ShouldBindJSON(&input); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+		if input.RefreshToken == "" {
+			cookie, err := c.Cookie(refreshCookieName)
+			if err != nil || cookie == "" {
+				c.JSON(400, gin.H{"error": "Refresh token required"})
+				return
+			}
+			if !validCSRF(c) {
+				c.JSON(403, gin.H{"error": "Invalid CSRF token"})
+				return
+			}
+			input.RefreshToken = cookie
+		}
+
+		session, refreshToken, err := sessionService.Rotate(input.RefreshToken, c.Request.UserAgent(), c.ClientIP())
+		if errors.Is(err, ErrSessionRotated) {
+			c.JSON(409, gin.H{"error": "Session was just refreshed, use the new token"})
+			return
+		}
+		if err != nil {
+			c.JSON(401, gin.H{"error": "Invalid or expired refresh token"})
+			return
+		}
+
+		var user User
+		if err := db.First(&user, session.UserID).Error; err != nil {
+			c.JSON(401, gin.H{"error": "Invalid or expired refresh token"})
+			return
+		}
+
+		response, err := issueTokens(user, session, refreshToken)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to generate token"})
+			return
+		}
+
+		if err := writeAuthCookies(c, response); err != nil {
+			c.JSON(500, gin.H{"error": "Failed to generate token"})
+			return
+		}
+
+		recordSecurityEvent(db, c, EventTokenRefresh, user.ID, user.Email, "session "+strconv.FormatUint(uint64(session.ID), 10))
+		c.JSON(200, response)
+	}
+}
+
+func handleLogout(db *gorm.DB) gin.HandlerFunc {
+	sessionService := NewSessionService(db)
+
+	return func(c *gin.Context) {
+		userID := c.GetUint("userID")
+		sessionID := c.GetUint("sessionID")
+
+		if err := sessionService.Revoke(sessionID, userID); err != nil && !errors.Is(err, ErrSessionNotFound) {
+			c.JSON(500, gin.H{"error": "Failed to log out"})
+			return
+		}
+
+		clearAuthCookies(c)
+		c.JSON(200, gin.H{"message": "Logged out successfully"})
+	}
+}
+
+func getSessions(db *gorm.DB) gin.HandlerFunc {
+	sessionService := NewSessionService(db)
+
+	return func(c *gin.Context) {
+		userID := c.GetUint("userID")
+		currentSessionID := c.GetUint("sessionID")
+
+		sessions, err := sessionService.ListActive(userID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch sessions"})
+			return
+		}
+
+		result := make([]gin.H, 0, len(sessions))
+		for _, session := range sessions {
+			result = append(result, gin.H{
+				"id":           session.ID,
+				"user_agent":   session.UserAgent,
+				"ip":           session.IP,
+				"created_at":   session.CreatedAt,
+				"last_seen_at": session.LastSeenAt,
+				"current":      session.ID == currentSessionID,
+			})
+		}
+
+		c.JSON(http.StatusOK, gin.H{"sessions": result})
+	}
+}
+
+func revokeSession(db *gorm.DB) gin.HandlerFunc {
+	sessionService := NewSessionService(db)
+
+	return func(c *gin.Context) {
+		userID := c.GetUint("userID")
+
+		sessionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid session ID"})
+			return
+		}
+
+		if err := sessionService.Revoke(uint(sessionID), userID); err != nil {
+			if errors.Is(err, ErrSessionNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Session not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke session"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Session revoked"})
+	}
+}
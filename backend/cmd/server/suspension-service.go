@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Suspension scopes
+const (
+	SuspensionReadOnly = "read_only" // can log in, read and manage their account, but not post
+	SuspensionFull     = "full"      // can't log in at all
+)
+
+var ErrSuspensionNotFound = errors.New("suspension not found")
+
+// Full suspensions outrank read only ones, then the one lasting longest
+const suspensionOrder = "CASE WHEN scope = 'full' THEN 0 ELSE 1 END, expires_at DESC NULLS FIRST"
+
+type SuspensionService struct {
+	db *gorm.DB
+}
+
+func NewSuspensionService(db *gorm.DB) *SuspensionService {
+	return &SuspensionService{db: db}
+}
+
+// Active returns the user's strongest suspension in force, or nil if they
+// have none
+func (s *SuspensionService) Active(userID uint) (*Suspension, error) {
+	var suspension Suspension
+	err := s.db.
+		Where("user_id = ? AND lifted_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now()).
+		Order(suspensionOrder).
+		First(&suspension).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &suspension, nil
+}
+
+// Suspend adds a suspension. A full one also logs the user out everywhere.
+func (s *SuspensionService) Suspend(userID, createdByID uint, scope, reason string, expiresAt *time.Time) (*Suspension, error) {
+	suspension := Suspension{
+		UserID:      userID,
+		Scope:       scope,
+		Reason:      reason,
+		ExpiresAt:   expiresAt,
+		CreatedByID: createdByID,
+	}
+	if err := s.db.Create(&suspension).Error; err != nil {
+		return nil, err
+	}
+
+	if scope == SuspensionFull {
+		if err := revokeCredentials(s.db, userID, 0); err != nil {
+			return &suspension, err
+		}
+	}
+	return &suspension, nil
+}
+
+// Lift ends one of the user's suspensions early
+func (s *SuspensionService) Lift(suspensionID, userID, liftedByID uint) (*Suspension, error) {
+	result := s.db.Model(&Suspension{}).
+		Where("id = ? AND user_id = ? AND lifted_at IS NULL", suspensionID, userID).
+		Updates(map[string]interface{}{"lifted_at": time.Now(), "lifted_by_id": liftedByID})
+	if result.Error != nil {
+		return nil, result.Error
+	}
+	if result.RowsAffected == 0 {
+		return nil, ErrSuspensionNotFound
+	}
+
+	var suspension Suspension
+	if err := s.db.First(&suspension, suspensionID).Error; err != nil {
+		return nil, err
+	}
+	return &suspension, nil
+}
+
+// LiftExpired marks suspensions past their expiry as lifted, at the time
+// they expired
+func (s *SuspensionService) LiftExpired() (int64, error) {
+	result := s.db.Model(&Suspension{}).
+		Where("lifted_at IS NULL AND expires_at <= ?", time.Now()).
+		Update("lifted_at", gorm.Expr("expires_at"))
+	return result.RowsAffected, result.Error
+}
+
+func startSuspensionExpiry(db *gorm.DB) {
+	suspensionService := NewSuspensionService(db)
+	startBackgroundJob("suspension expiry", time.Minute, func() error {
+		lifted, err := suspensionService.LiftExpired()
+		if lifted > 0 {
+			fmt.Printf("Lifted %d expired suspensions\n", lifted)
+		}
+		return err
+	})
+}
+
+// suspendedResponse is the error payload for a suspended user, so the
+// frontend can say why and until when
+func suspendedResponse(suspension *Suspension) gin.H {
+	message := "Your account has been suspended"
+	if suspension.Scope == SuspensionReadOnly {
+		message = "Your account is read only while it is suspended"
+	}
+	return gin.H{
+		"error": message,
+		"suspension": gin.H{
+			"scope":      suspension.Scope,
+			"reason":     suspension.Reason,
+			"expires_at": suspension.ExpiresAt,
+		},
+	}
+}
+
+// isContentWrite reports whether the request changes something other than
+// the caller's own account. Read only suspensions block these but still let
+// users manage their account under /api/profile and log out.
+func isContentWrite(c *gin.Context) bool {
+	switch c.Request.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return false
+	}
+	path := c.FullPath()
+	return path != "/api/auth/logout" && path != "/api/profile" && !strings.HasPrefix(path, "/api/profile/")
+}
+
+// enforceSuspension responds and returns false if a suspension stops the
+// request. Read only users can still read, manage their account and log out.
+func enforceSuspension(c *gin.Context, suspensionService *SuspensionService, userID uint) bool {
+	suspension, err := suspensionService.Active(userID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check account status"})
+		return false
+	}
+	if suspension == nil {
+		return true
+	}
+
+	if suspension.Scope == SuspensionReadOnly && !isContentWrite(c) {
+		return true
+	}
+
+	c.JSON(http.StatusForbidden, suspendedResponse(suspension))
+	return false
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestIsContentWrite(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		method, route string
+		want          bool
+	}{
+		{http.MethodGet, "/api/threads/:id", false},
+		{http.MethodPost, "/api/threads", true},
+		{http.MethodPost, "/api/threads/:id/replies", true},
+		{http.MethodDelete, "/api/threads/:id", true},
+		{http.MethodPatch, "/api/profile", false},
+		{http.MethodPut, "/api/profile/password", false},
+		{http.MethodPost, "/api/profile/2fa/enable", false},
+		{http.MethodDelete, "/api/profile/sessions/:id", false},
+		{http.MethodPost, "/api/auth/logout", false},
+		{http.MethodPatch, "/api/users/:userId/role", true},
+	}
+	for _, tt := range tests {
+		var got bool
+		r := gin.New()
+		r.Handle(tt.method, tt.route, func(c *gin.Context) { got = isContentWrite(c) })
+		r.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(tt.method, routeExample(tt.route), nil))
+		if got != tt.want {
+			t.Errorf("%s %s: isContentWrite = %v, want %v", tt.method, tt.route, got, tt.want)
+		}
+	}
+}
+
+// routeExample fills in a route's parameters so it can be requested
+func routeExample(route string) string {
+	example := []byte{}
+	for i := 0; i < len(route); i++ {
+		if route[i] == ':' {
+			example = append(example, '1')
+			for i+1 < len(route) && route[i+1] != '/' {
+				i++
+			}
+			continue
+		}
+		example = append(example, route[i])
+	}
+	return string(example)
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// loadSuspendableUser fetches the user named in the URL
+func loadSuspendableUser(c *gin.Context, db *gorm.DB) (*User, bool) {
+	userID, err := strconv.ParseUint(c.Param("userId"), 10, 32)
+	if err != nil || userID == 0 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+		return nil, false
+	}
+
+	var user User
+	if err := db.Preload("Role").First(&user, userID).Error; err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+		return nil, false
+	}
+	return &user, true
+}
+
+func getUserSuspensions(db *gorm.DB) gin.HandlerFunc {
+	suspensionService := NewSuspensionService(db)
+
+	return func(c *gin.Context) {
+		user, ok := loadSuspendableUser(c, db)
+		if !ok {
+			return
+		}
+
+		var suspensions []Suspension
+		if err := db.Where("user_id = ?", user.ID).Order("created_at DESC").Find(&suspensions).Error; err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch suspensions"})
+			return
+		}
+		active, err := suspensionService.Active(user.ID)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch suspensions"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"active":      active,
+			"suspensions": suspensions,
+		})
+	}
+}
+
+// suspendUser suspends a user for expires_in_hours, or bans them when it is
+// left out or 0
+func suspendUser(db *gorm.DB) gin.HandlerFunc {
+	suspensionService := NewSuspensionService(db)
+
+	return func(c *gin.Context) {
+		target, ok := loadSuspendableUser(c, db)
+		if !ok {
+			return
+		}
+
+		var input struct {
+			Scope          string `json:"scope" binding:"required,oneof=read_only full"`
+			Reason         string `json:"reason" binding:"required,max=500"`
+			ExpiresInHours int    `json:"expires_in_hours" binding:"min=0,max=87600"`
+		}
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		reason := strings.TrimSpace(input.Reason)
+		if reason == "" {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "A reason is required"})
+			return
+		}
+
+		actor, err := currentUser(c, db)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		if actor.ID == target.ID {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "You can't suspend yourself"})
+			return
+		}
+		if !actor.Role.Outranks(target.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can't suspend someone with the same or more permissions than you"})
+			return
+		}
+
+		var expiresAt *time.Time
+		if input.ExpiresInHours > 0 {
+			t := time.Now().Add(time.Duration(input.ExpiresInHours) * time.Hour)
+			expiresAt = &t
+		}
+
+		suspension, err := suspensionService.Suspend(target.ID, actor.ID, input.Scope, reason, expiresAt)
+		if err != nil {
+			if suspension == nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to suspend user"})
+				return
+			}
+			// The suspension itself still applies at their next request
+			fmt.Println("Error revoking sessions after suspension:", err)
+		}
+
+		recordAudit(db, c, AuditUserSuspended, AuditTargetUser, target.ID, nil, auditSuspension(suspension))
+
+		c.JSON(http.StatusCreated, suspension)
+	}
+}
+
+func liftSuspension(db *gorm.DB) gin.HandlerFunc {
+	suspensionService := NewSuspensionService(db)
+
+	return func(c *gin.Context) {
+		target, ok := loadSuspendableUser(c, db)
+		if !ok {
+			return
+		}
+		suspensionID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid suspension ID"})
+			return
+		}
+
+		// Otherwise a moderator could lift another moderator's suspension
+		// that an admin put in place
+		actor, err := currentUser(c, db)
+		if err != nil {
+			c.JSON(http.StatusUnauthorized, gin.H{"error": "Unauthorized"})
+			return
+		}
+		if !actor.Role.Outranks(target.Role) {
+			c.JSON(http.StatusForbidden, gin.H{"error": "You can't lift a suspension for someone with the same or more permissions than you"})
+			return
+		}
+
+		suspension, err := suspensionService.Lift(uint(suspensionID), target.ID, actor.ID)
+		if err != nil {
+			if errors.Is(err, ErrSuspensionNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Suspension not found or already lifted"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to lift suspension"})
+			return
+		}
+
+		recordAudit(db, c, AuditSuspensionLifted, AuditTargetUser, target.ID, nil, auditSuspension(suspension))
+
+		c.JSON(http.StatusOK, suspension)
+	}
+}
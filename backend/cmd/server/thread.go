@@ -14,8 +14,23 @@ func createThread(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		userID := getUserIdFromToken(c)
-		thread.UserID = userID
+		user, err := currentUser(c, db)
+		if err != nil {
+			c.JSON(401, gin.H{"error": "Unauthorized"})
+			return
+		}
+		access, err := sectionAccess(c, db)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check section access"})
+			return
+		}
+		// Stored the way access checks see it, so filters on the column match
+		thread.Section = normaliseSection(thread.Section)
+		if !access.CanPost(thread.Section) {
+			c.JSON(403, gin.H{"error": "You can't post in this section"})
+			return
+		}
+		thread.UserID = user.ID
 
 		if err := db.Create(&thread).Error; err != nil {
 			c.JSON(500, gin.H{"error": err.Error()})
@@ -35,6 +50,16 @@ func getThreadsBySection(db *gorm.DB) gin.HandlerFunc {
 		var threads []Thread
 		section := c.Param("section")
 
+		access, err := sectionAccess(c, db)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check section access"})
+			return
+		}
+		if !access.CanRead(section) {
+			c.JSON(403, gin.H{"error": "You can't view this section"})
+			return
+		}
+
 		if err := db.Where("section = ?", section).
 			Preload("User").
 			Preload("Replies").
@@ -66,6 +91,67 @@ func getThread(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		// Same response as a missing thread so hidden ones can't be found
+		access, err := sectionAccess(c, db)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check section access"})
+			return
+		}
+		if !access.CanRead(thread.Section) {
+			c.JSON(404, gin.H{"error": "Thread not found"})
+			return
+		}
+
 		c.JSON(200, thread)
 	}
 }
+
+// Delete a thread and its replies. Authors can delete their own, anyone
+// else needs to moderate the section.
+func deleteThread(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var thread Thread
+		if err := db.First(&thread, c.Param("id")).Error; err != nil {
+			c.JSON(404, gin.H{"error": "Thread not found"})
+			return
+		}
+
+		user, err := currentUser(c, db)
+		if err != nil {
+			c.JSON(401, gin.H{"error": "Unauthorized"})
+			return
+		}
+		access, err := sectionAccess(c, db)
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check section access"})
+			return
+		}
+		if !access.CanRead(thread.Section) {
+			c.JSON(404, gin.H{"error": "Thread not found"})
+			return
+		}
+		moderating := thread.UserID != user.ID
+		if moderating && !access.CanModerate(thread.Section) {
+			c.JSON(403, gin.H{"error": "You can't moderate this section"})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Where("thread_id = ?", thread.ID).Delete(&Reply{}).Error; err != nil {
+				return err
+			}
+			return tx.Delete(&thread).Error
+		})
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to delete thread"})
+			return
+		}
+
+		if moderating {
+			recordAudit(db, c, AuditThreadDeleted, AuditTargetThread, thread.ID,
+				gin.H{"section": thread.Section, "user_id": thread.UserID}, nil)
+		}
+
+		c.JSON(200, gin.H{"message": "Thread deleted"})
+	}
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/stefvuck/forum/internal/auth"
+)
+
+// Personal access tokens look like gud_pat_<random> so they are easy to tell
+// apart from JWTs and to spot if leaked
+const accessTokenPrefix = "gud_pat_"
+
+const maxAccessTokensPerUser = 20
+
+// Scopes a personal access token can be granted
+const (
+	ScopeThreadsRead  = "threads:read"
+	ScopeThreadsWrite = "threads:write"
+	ScopeRepliesWrite = "replies:write"
+)
+
+var knownScopes = map[string]bool{
+	ScopeThreadsRead:  true,
+	ScopeThreadsWrite: true,
+	ScopeRepliesWrite: true,
+}
+
+// routeScopes lists the only routes a personal access token may call, by
+// method and gin route path. Anything else is session only.
+var routeScopes = map[string]string{
+	"GET /api/sections/:section/threads": ScopeThreadsRead,
+	"GET /api/threads/:id":               ScopeThreadsRead,
+	"GET /api/threads/:id/replies":       ScopeThreadsRead,
+	"GET /api/search":                    ScopeThreadsRead,
+	"POST /api/threads":                  ScopeThreadsWrite,
+	"POST /api/threads/:id/replies":      ScopeRepliesWrite,
+}
+
+var (
+	ErrAccessTokenInvalid = errors.New("invalid access token")
+	ErrTooManyTokens      = errors.New("too many access tokens")
+)
+
+func isAccessToken(token string) bool {
+	return strings.HasPrefix(token, accessTokenPrefix)
+}
+
+// HasScope reports whether the token was granted scope
+func (t AccessToken) HasScope(scope string) bool {
+	for _, s := range strings.Split(t.Scopes, ",") {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type AccessTokenService struct {
+	db *gorm.DB
+}
+
+func NewAccessTokenService(db *gorm.DB) *AccessTokenService {
+	return &AccessTokenService{db: db}
+}
+
+// Create issues a token and returns it with the plaintext value, which is
+// never stored and can't be shown again
+func (s *AccessTokenService) Create(userID uint, name string, scopes []string, expiresAt *time.Time) (*AccessToken, string, error) {
+	var count int64
+	if err := s.db.Model(&AccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", userID, time.Now()).
+		Count(&count).Error; err != nil {
+		return nil, "", err
+	}
+	if count >= maxAccessTokensPerUser {
+		return nil, "", ErrTooManyTokens
+	}
+
+	random, err := auth.GenerateRandomToken()
+	if err != nil {
+		return nil, "", err
+	}
+	plaintext := accessTokenPrefix + strings.TrimRight(random, "=")
+
+	token := &AccessToken{
+		UserID:    userID,
+		Name:      name,
+		TokenHash: auth.HashToken(plaintext),
+		Prefix:    plaintext[:len(accessTokenPrefix)+6],
+		Scopes:    strings.Join(scopes, ","),
+		ExpiresAt: expiresAt,
+	}
+	if err := s.db.Create(token).Error; err != nil {
+		return nil, "", err
+	}
+	return token, plaintext, nil
+}
+
+// Authenticate resolves a plaintext token to its record and owner
+func (s *AccessTokenService) Authenticate(plaintext string) (*AccessToken, *User, error) {
+	var token AccessToken
+	if err := s.db.Where("token_hash = ?", auth.HashToken(plaintext)).First(&token).Error; err != nil {
+		return nil, nil, ErrAccessTokenInvalid
+	}
+	if token.RevokedAt != nil {
+		return nil, nil, ErrAccessTokenInvalid
+	}
+	if token.ExpiresAt != nil && time.Now().After(*token.ExpiresAt) {
+		return nil, nil, ErrAccessTokenInvalid
+	}
+
+	var user User
+	if err := s.db.First(&user, token.UserID).Error; err != nil {
+		return nil, nil, ErrAccessTokenInvalid
+	}
+
+	if token.LastUsedAt == nil || time.Since(*token.LastUsedAt) > sessionTouchInterval {
+		s.db.Model(&token).Update("last_used_at", time.Now())
+	}
+	return &token, &user, nil
+}
+
+func (s *AccessTokenService) List(userID uint) ([]AccessToken, error) {
+	var tokens []AccessToken
+	err := s.db.Where("user_id = ? AND revoked_at IS NULL", userID).
+		Order("created_at desc").
+		Find(&tokens).Error
+	return tokens, err
+}
+
+func (s *AccessTokenService) Revoke(tokenID, userID uint) error {
+	result := s.db.Model(&AccessToken{}).
+		Where("id = ? AND user_id = ? AND revoked_at IS NULL", tokenID, userID).
+		Update("revoked_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return gorm.ErrRecordNotFound
+	}
+	return nil
+}
+
+// RevokeAll revokes every token the user has
+func (s *AccessTokenService) RevokeAll(userID uint) error {
+	return s.db.Model(&AccessToken{}).
+		Where("user_id = ? AND revoked_at IS NULL", userID).
+		Update("revoked_at", time.Now()).Error
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+func getAccessTokens(db *gorm.DB) gin.HandlerFunc {
+	tokenService := NewAccessTokenService(db)
+
+	return func(c *gin.Context) {
+		tokens, err := tokenService.List(c.GetUint("userID"))
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch access tokens"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"tokens": tokens})
+	}
+}
+
+func createAccessToken(db *gorm.DB) gin.HandlerFunc {
+	tokenService := NewAccessTokenService(db)
+
+	return func(c *gin.Context) {
+		var input struct {
+			Name          string   `json:"name" binding:"required,max=100"`
+			Scopes        []string `json:"scopes" binding:"required,min=1"`
+			ExpiresInDays int      `json:"expires_in_days" binding:"min=0,max=365"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		scopes := make([]string, 0, len(input.Scopes))
+		seen := make(map[string]bool)
+		for _, scope := range input.Scopes {
+			scope = strings.TrimSpace(scope)
+			if !knownScopes[scope] {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Unknown scope: " + scope})
+				return
+			}
+			if !seen[scope] {
+				seen[scope] = true
+				scopes = append(scopes, scope)
+			}
+		}
+		sort.Strings(scopes)
+
+		// Zero means the token never expires
+		var expiresAt *time.Time
+		if input.ExpiresInDays > 0 {
+			t := time.Now().AddDate(0, 0, input.ExpiresInDays)
+			expiresAt = &t
+		}
+
+		token, plaintext, err := tokenService.Create(c.GetUint("userID"), strings.TrimSpace(input.Name), scopes, expiresAt)
+		if err != nil {
+			if errors.Is(err, ErrTooManyTokens) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "You have too many access tokens, revoke one first"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to create access token"})
+			return
+		}
+
+		c.JSON(http.StatusCreated, gin.H{
+			"message": "Copy this token now, it won't be shown again",
+			"token":   plaintext,
+			"details": token,
+		})
+	}
+}
+
+func revokeAccessToken(db *gorm.DB) gin.HandlerFunc {
+	tokenService := NewAccessTokenService(db)
+
+	return func(c *gin.Context) {
+		tokenID, err := strconv.ParseUint(c.Param("id"), 10, 32)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid token ID"})
+			return
+		}
+
+		if err := tokenService.Revoke(uint(tokenID), c.GetUint("userID")); err != nil {
+			if errors.Is(err, gorm.ErrRecordNotFound) {
+				c.JSON(http.StatusNotFound, gin.H{"error": "Access token not found"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to revoke access token"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Access token revoked"})
+	}
+}
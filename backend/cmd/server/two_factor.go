@@ -0,0 +1,426 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/stefvuck/forum/internal/auth"
+	"github.com/stefvuck/forum/internal/mailer"
+)
+
+const totpIssuer = "GU Drones Forum"
+
+const recoveryCodeCount = 10
+
+var (
+	ErrTwoFactorEnabled    = errors.New("two factor authentication is already enabled")
+	ErrTwoFactorNotStarted = errors.New("two factor setup has not been started")
+	ErrInvalidTwoFactor    = errors.New("invalid two factor code")
+)
+
+/*
+
+2FA helpers
+
+*/
+
+// startTOTPSetup stores a new pending secret for the user and returns what
+// the authenticator app needs. The secret only takes effect once confirmed.
+func startTOTPSetup(db *gorm.DB, user *User) (gin.H, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := db.Model(user).Updates(map[string]interface{}{
+		"totp_secret":    secret,
+		"totp_last_step": 0,
+	}).Error; err != nil {
+		return nil, err
+	}
+
+	return gin.H{
+		"secret":      secret,
+		"otpauth_uri": auth.TOTPURI(totpIssuer, user.Email, secret),
+	}, nil
+}
+
+// enableTOTP confirms the pending secret with a code from the app and
+// returns a fresh set of recovery codes
+func enableTOTP(db *gorm.DB, user *User, code string) ([]string, error) {
+	if user.TOTPEnabled {
+		return nil, ErrTwoFactorEnabled
+	}
+	if user.TOTPSecret == "" {
+		return nil, ErrTwoFactorNotStarted
+	}
+
+	step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now(), 0)
+	if !ok {
+		return nil, ErrInvalidTwoFactor
+	}
+
+	var codes []string
+	err := db.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Model(user).Updates(map[string]interface{}{
+			"totp_enabled":   true,
+			"totp_last_step": step,
+		}).Error; err != nil {
+			return err
+		}
+
+		var err error
+		codes, err = replaceRecoveryCodes(tx, user.ID)
+		return err
+	})
+	return codes, err
+}
+
+// replaceRecoveryCodes discards any existing recovery codes and issues new ones
+func replaceRecoveryCodes(tx *gorm.DB, userID uint) ([]string, error) {
+	if err := tx.Where("user_id = ?", userID).Delete(&RecoveryCode{}).Error; err != nil {
+		return nil, err
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+
+	records := make([]RecoveryCode, len(codes))
+	for i, code := range codes {
+		records[i] = RecoveryCode{UserID: userID, CodeHash: auth.HashToken(code)}
+	}
+	if err := tx.Create(&records).Error; err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused
+// recovery code. Both are single use.
+func verifySecondFactor(db *gorm.DB, user *User, code string) bool {
+	if !user.TOTPEnabled {
+		return false
+	}
+
+	if step, ok := auth.ValidateTOTP(user.TOTPSecret, code, time.Now(), user.TOTPLastStep); ok {
+		// Conditional update so the same code can't be used twice concurrently
+		result := db.Model(&User{}).
+			Where("id = ? AND totp_last_step < ?", user.ID, step).
+			Update("totp_last_step", step)
+		return result.Error == nil && result.RowsAffected == 1
+	}
+
+	codeHash := auth.HashToken(auth.NormalizeRecoveryCode(code))
+	result := db.Model(&RecoveryCode{}).
+		Where("user_id = ? AND code_hash = ? AND used_at IS NULL", user.ID, codeHash).
+		Update("used_at", time.Now())
+	return result.Error == nil && result.RowsAffected == 1
+}
+
+/*
+
+Login second step
+
+*/
+
+// loadChallengeUser resolves the user behind a challenge token
+func loadChallengeUser(db *gorm.DB, challengeToken string) (*User, error) {
+	claims, err := auth.ParseChallengeToken(challengeToken)
+	if err != nil {
+		return nil, err
+	}
+
+	var user User
+	if err := db.Preload("Role").First(&user, claims.UserID).Error; err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+func handleVerifyTwoFactor(db *gorm.DB, mail mailer.Mailer, guard *LoginGuard) gin.HandlerFunc {
+	sessionService := NewSessionService(db)
+
+	return func(c *gin.Context) {
+		var input struct {
+			ChallengeToken string `json:"challenge_token" binding:"required"`
+			Code           string `json:"code" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, err := loadChallengeUser(db, input.ChallengeToken)
+		if err != nil {
+			c.JSON(401, gin.H{"error": "Invalid or expired challenge token"})
+			return
+		}
+
+		// Codes are only 6 digits, so guess limiting matters as much as for passwords
+		wait, err := guard.Check(user.Email, c.ClientIP())
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to check login attempts"})
+			return
+		}
+		if wait > 0 {
+			c.JSON(429, gin.H{"error": "Too many failed login attempts. Please try again later."})
+			return
+		}
+
+		if !verifySecondFactor(db, user, input.Code) {
+			loginFailed(c, db, guard, mail, user.Email, user, "invalid two factor code")
+			c.JSON(401, gin.H{"error": "Invalid two factor code"})
+			return
+		}
+
+		if err := guard.RecordSuccess(user.Email); err != nil {
+			fmt.Println("Error clearing login attempts:", err)
+		}
+
+		completeLogin(c, sessionService, *user, nil)
+	}
+}
+
+// handleLoginTwoFactorSetup lets a user whose role requires 2FA enrol before
+// their first login completes
+func handleLoginTwoFactorSetup(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			ChallengeToken string `json:"challenge_token" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, err := loadChallengeUser(db, input.ChallengeToken)
+		if err != nil {
+			c.JSON(401, gin.H{"error": "Invalid or expired challenge token"})
+			return
+		}
+
+		setup, err := startTOTPSetup(db, user)
+		if err != nil {
+			if errors.Is(err, ErrTwoFactorEnabled) {
+				c.JSON(409, gin.H{"error": "Two factor authentication is already enabled"})
+				return
+			}
+			c.JSON(500, gin.H{"error": "Failed to start two factor setup"})
+			return
+		}
+
+		c.JSON(200, setup)
+	}
+}
+
+func handleLoginTwoFactorEnable(db *gorm.DB) gin.HandlerFunc {
+	sessionService := NewSessionService(db)
+
+	return func(c *gin.Context) {
+		var input struct {
+			ChallengeToken string `json:"challenge_token" binding:"required"`
+			Code           string `json:"code" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, err := loadChallengeUser(db, input.ChallengeToken)
+		if err != nil {
+			c.JSON(401, gin.H{"error": "Invalid or expired challenge token"})
+			return
+		}
+
+		codes, err := enableTOTP(db, user, input.Code)
+		if err != nil {
+			respondTwoFactorError(c, err)
+			return
+		}
+
+		completeLogin(c, sessionService, *user, gin.H{"recovery_codes": codes})
+	}
+}
+
+func respondTwoFactorError(c *gin.Context, err error) {
+	switch {
+	case errors.Is(err, ErrTwoFactorEnabled):
+		c.JSON(http.StatusConflict, gin.H{"error": "Two factor authentication is already enabled"})
+	case errors.Is(err, ErrTwoFactorNotStarted):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Two factor setup has not been started"})
+	case errors.Is(err, ErrInvalidTwoFactor):
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two factor code"})
+	default:
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update two factor authentication"})
+	}
+}
+
+/*
+
+Profile 2FA management
+
+*/
+
+func getTwoFactorStatus(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := currentUser(c, db)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		var remaining int64
+		db.Model(&RecoveryCode{}).Where("user_id = ? AND used_at IS NULL", user.ID).Count(&remaining)
+
+		c.JSON(http.StatusOK, gin.H{
+			"enabled":                  user.TOTPEnabled,
+			"required":                 user.Role.TwoFactorRequired(),
+			"recovery_codes_remaining": remaining,
+		})
+	}
+}
+
+func setupTwoFactor(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		user, err := currentUser(c, db)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		setup, err := startTOTPSetup(db, user)
+		if err != nil {
+			respondTwoFactorError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, setup)
+	}
+}
+
+func enableTwoFactor(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Code string `json:"code" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, err := currentUser(c, db)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		codes, err := enableTOTP(db, user, input.Code)
+		if err != nil {
+			respondTwoFactorError(c, err)
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{
+			"message":        "Two factor authentication enabled",
+			"recovery_codes": codes,
+		})
+	}
+}
+
+func disableTwoFactor(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Code string `json:"code" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, err := currentUser(c, db)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		if user.Role.TwoFactorRequired() {
+			c.JSON(http.StatusForbidden, gin.H{"error": "Two factor authentication is required for your role"})
+			return
+		}
+
+		if !verifySecondFactor(db, user, input.Code) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two factor code"})
+			return
+		}
+
+		err = db.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Model(user).Updates(map[string]interface{}{
+				"totp_enabled":   false,
+				"totp_secret":    "",
+				"totp_last_step": 0,
+			}).Error; err != nil {
+				return err
+			}
+			return tx.Where("user_id = ?", user.ID).Delete(&RecoveryCode{}).Error
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to disable two factor authentication"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"message": "Two factor authentication disabled"})
+	}
+}
+
+func regenerateRecoveryCodes(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Code string `json:"code" binding:"required"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		user, err := currentUser(c, db)
+		if err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
+		if !verifySecondFactor(db, user, input.Code) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid two factor code"})
+			return
+		}
+
+		var codes []string
+		err = db.Transaction(func(tx *gorm.DB) error {
+			var err error
+			codes, err = replaceRecoveryCodes(tx, user.ID)
+			return err
+		})
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate recovery codes"})
+			return
+		}
+
+		c.JSON(http.StatusOK, gin.H{"recovery_codes": codes})
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"encoding/json"
 	"time"
 
 	"gorm.io/gorm"
@@ -14,12 +15,203 @@ type User struct {
 	RoleID            uint      `json:"role_id"`
 	Role              Role      `json:"role" gorm:"foreignKey:RoleID"`
 	Verified          bool      `json:"verified"`
-	VerifyToken       string    `json:"-"`
+	VerifyToken       string    `json:"-"` // SHA-256 of the emailed verification token
 	VerifyExpires     time.Time `json:"-"`
+	VerifySentAt      time.Time `json:"-"`
+	ResetToken        string    `json:"-"` // SHA-256 of the emailed reset token
+	ResetExpires      time.Time `json:"-"`
+	TOTPSecret        string    `json:"-"`
+	TOTPEnabled       bool      `json:"totp_enabled"`
+	TOTPLastStep      int64     `json:"-"`              // last accepted time step, stops codes being replayed
+	OIDCSubject       string    `json:"-" gorm:"index"` // "sub" claim from university single sign-on
+	ApprovalStatus    string    `json:"approval_status" gorm:"default:approved;index"`
+	AllowedSections   string    `json:"allowed_sections"` // comma-separated sections an invited user may post in, empty for all
 	Bio               string    `json:"bio"`
 	ProfilePictureURL string    `json:"profile_picture_url"`
-	Threads           []Thread
-	Replies           []Reply
+	// Set when the user asks to delete their account, which is anonymised
+	// once it passes unless they cancel
+	DeletionScheduledAt *time.Time `json:"-" gorm:"index"`
+	AnonymisedAt        *time.Time `json:"-"`
+	Threads             []Thread
+	Replies             []Reply
+}
+
+// Session is a logged in device, identified by its rotating refresh token
+type Session struct {
+	gorm.Model
+	UserID        uint       `json:"user_id" gorm:"index"`
+	RefreshToken  string     `json:"-" gorm:"uniqueIndex"` // SHA-256 of the current refresh token
+	PreviousToken string     `json:"-" gorm:"index"`       // SHA-256 of the last rotated token, for reuse detection
+	RotatedAt     *time.Time `json:"-"`                    // when PreviousToken was rotated out
+	UserAgent     string     `json:"user_agent"`
+	IP            string     `json:"ip"`
+	LastSeenAt    time.Time  `json:"last_seen_at"`
+	ExpiresAt     time.Time  `json:"expires_at"`
+	RevokedAt     *time.Time `json:"revoked_at"`
+}
+
+// EmailDomain allows registration from a domain and picks the new account's role
+type EmailDomain struct {
+	gorm.Model
+	Domain string `json:"domain" gorm:"uniqueIndex"` // lowercase, without the @
+	RoleID uint   `json:"role_id"`
+	Role   Role   `json:"role" gorm:"foreignKey:RoleID"`
+	// Role given to users holding RoleID when they remove their address on
+	// this domain, e.g. students becoming alumni. Nil leaves the role alone.
+	AlumniRoleID *uint `json:"alumni_role_id"`
+	AlumniRole   *Role `json:"alumni_role,omitempty" gorm:"foreignKey:AlumniRoleID"`
+}
+
+// UserEmail is an extra address on an account. The primary address stays in
+// User.Email, making one of these primary swaps the two.
+type UserEmail struct {
+	gorm.Model
+	UserID        uint      `json:"user_id" gorm:"index"`
+	Email         string    `json:"email" gorm:"index"`
+	Verified      bool      `json:"verified"`
+	VerifyToken   string    `json:"-" gorm:"index"` // SHA-256 of the emailed verification token
+	VerifyExpires time.Time `json:"-"`
+}
+
+// EmailChange is a pending change of User.Email. It completes when the new
+// address confirms it and can be cancelled from the old address.
+type EmailChange struct {
+	gorm.Model
+	UserID       uint       `json:"user_id" gorm:"index"`
+	NewEmail     string     `json:"new_email"`
+	ConfirmToken string     `json:"-" gorm:"uniqueIndex"` // SHA-256 of the token emailed to the new address
+	CancelToken  string     `json:"-" gorm:"uniqueIndex"` // SHA-256 of the token emailed to the old address
+	ExpiresAt    time.Time  `json:"expires_at"`
+	CompletedAt  *time.Time `json:"completed_at"`
+	CancelledAt  *time.Time `json:"cancelled_at"`
+}
+
+// Invite lets people outside the allowed email domains register, such as
+// mentors and sponsors. Only the hash of the code is stored.
+type Invite struct {
+	gorm.Model
+	CodeHash    string             `json:"-" gorm:"uniqueIndex"`
+	Prefix      string             `json:"prefix"` // start of the code, to tell invites apart
+	Note        string             `json:"note"`
+	RoleID      uint               `json:"role_id"`
+	Role        Role               `json:"role" gorm:"foreignKey:RoleID"`
+	Sections    string             `json:"sections"` // comma-separated, copied to the user's AllowedSections
+	MaxUses     int                `json:"max_uses"`
+	Uses        int                `json:"uses"`
+	ExpiresAt   *time.Time         `json:"expires_at"`
+	RevokedAt   *time.Time         `json:"revoked_at"`
+	CreatedByID uint               `json:"created_by_id"`
+	Redemptions []InviteRedemption `json:"redemptions,omitempty"`
+}
+
+// InviteRedemption records who registered with an invite
+type InviteRedemption struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	InviteID  uint      `json:"invite_id" gorm:"index"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	User      User      `json:"user" gorm:"constraint:OnDelete:CASCADE"`
+	CreatedAt time.Time `json:"redeemed_at"`
+}
+
+// SectionRule grants a role, or a single user, access to a section. Sections
+// without any rules are open to everyone, once a section has a rule only the
+// roles and users it names can see it. Post implies read and moderate
+// implies both.
+type SectionRule struct {
+	gorm.Model
+	Section     string `json:"section" gorm:"index"` // lowercase section id, e.g. "team"
+	RoleID      *uint  `json:"role_id"`
+	Role        *Role  `json:"role,omitempty" gorm:"foreignKey:RoleID"`
+	UserID      *uint  `json:"user_id"`
+	User        *User  `json:"user,omitempty" gorm:"foreignKey:UserID"`
+	CanRead     bool   `json:"can_read"`
+	CanPost     bool   `json:"can_post"`
+	CanModerate bool   `json:"can_moderate"`
+}
+
+// SecurityEvent is an entry in an account's login and security history.
+// UserID is 0 for failed logins to an email with no account.
+type SecurityEvent struct {
+	ID        uint      `json:"id" gorm:"primarykey"`
+	UserID    uint      `json:"user_id" gorm:"index"`
+	Email     string    `json:"email"`
+	Type      string    `json:"type" gorm:"index"`
+	Details   string    `json:"details"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	CreatedAt time.Time `json:"created_at" gorm:"index"`
+}
+
+// Suspension stops a user posting (read only) or using the forum at all
+// (full) until it expires or is lifted. One without an expiry is a ban.
+type Suspension struct {
+	gorm.Model
+	UserID      uint       `json:"user_id" gorm:"index"`
+	Scope       string     `json:"scope"` // SuspensionReadOnly or SuspensionFull
+	Reason      string     `json:"reason"`
+	ExpiresAt   *time.Time `json:"expires_at" gorm:"index"`
+	CreatedByID uint       `json:"created_by_id"`
+	LiftedAt    *time.Time `json:"lifted_at"`
+	LiftedByID  *uint      `json:"lifted_by_id"` // nil when it expired on its own
+}
+
+// AuditLog records an administrative or moderation action. Rows are never
+// updated or deleted, a database trigger refuses both.
+type AuditLog struct {
+	ID         uint            `json:"id" gorm:"primarykey"`
+	ActorID    uint            `json:"actor_id" gorm:"index"`
+	Action     string          `json:"action" gorm:"index"`
+	TargetType string          `json:"target_type" gorm:"index:idx_audit_log_target"`
+	TargetID   uint            `json:"target_id" gorm:"index:idx_audit_log_target"`
+	Before     json.RawMessage `json:"before" gorm:"type:jsonb"` // null for creations
+	After      json.RawMessage `json:"after" gorm:"type:jsonb"`  // null for deletions
+	IP         string          `json:"ip"`
+	UserAgent  string          `json:"user_agent"`
+	CreatedAt  time.Time       `json:"created_at" gorm:"index"`
+}
+
+func (AuditLog) TableName() string {
+	return "audit_log"
+}
+
+// OIDCLoginState holds the PKCE verifier and nonce for a login in progress
+type OIDCLoginState struct {
+	ID           uint   `gorm:"primarykey"`
+	State        string `gorm:"uniqueIndex"` // SHA-256 of the state parameter
+	Nonce        string
+	CodeVerifier string
+	ExpiresAt    time.Time `gorm:"index"`
+	CreatedAt    time.Time
+}
+
+// AccessToken is a personal access token for scripts and bots
+type AccessToken struct {
+	gorm.Model
+	UserID     uint       `json:"user_id" gorm:"index"`
+	Name       string     `json:"name"`
+	TokenHash  string     `json:"-" gorm:"uniqueIndex"` // SHA-256 of the full token
+	Prefix     string     `json:"prefix"`               // first characters, to help users tell tokens apart
+	Scopes     string     `json:"scopes"`               // Comma-separated scopes
+	ExpiresAt  *time.Time `json:"expires_at"`
+	LastUsedAt *time.Time `json:"last_used_at"`
+	RevokedAt  *time.Time `json:"-"`
+}
+
+// RecoveryCode is a one-time fallback for a lost authenticator
+type RecoveryCode struct {
+	gorm.Model
+	UserID   uint   `gorm:"index"`
+	CodeHash string `gorm:"index"`
+	UsedAt   *time.Time
+}
+
+// LoginAttempt tracks failed logins for an account or IP, used by PostgresAttemptStore
+type LoginAttempt struct {
+	ID          uint      `gorm:"primarykey"`
+	Key         string    `gorm:"uniqueIndex"`
+	Failures    int       `gorm:"not null;default:0"`
+	LastFailure time.Time `gorm:"index"`
+	LockedUntil time.Time
 }
 
 // Reply model represents a reply to a thread
@@ -130,6 +322,9 @@ type Role struct {
 	Name        string      `json:"name" gorm:"unique"`
 	Color       string      `json:"color"`
 	Permissions Permissions `json:"permissions" gorm:"type:jsonb"`
+	// Members of this role must use two factor authentication. Always true in
+	// effect for roles that can manage roles or users, see TwoFactorRequired.
+	RequireTwoFactor bool `json:"require_two_factor"`
 }
 
 type ProfileUpdateInput struct {
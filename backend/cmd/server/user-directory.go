@@ -0,0 +1,372 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Sort keys for the admin user directory and the column each one orders by.
+// last_active is never NULL here so it can take part in the cursor.
+var directorySorts = map[string]string{
+	"name":        "LOWER(directory.name)",
+	"email":       "LOWER(directory.email)",
+	"joined":      "directory.created_at",
+	"last_active": "COALESCE(directory.last_active, 'epoch'::timestamptz)",
+	"threads":     "directory.thread_count",
+	"replies":     "directory.reply_count",
+}
+
+const (
+	directoryDefaultLimit = 50
+	directoryMaxLimit     = 200
+)
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// DirectoryUser is a user with their activity, as listed in the directory
+type DirectoryUser struct {
+	User
+	ThreadCount int64      `json:"thread_count"`
+	ReplyCount  int64      `json:"reply_count"`
+	LastActive  *time.Time `json:"last_active"` // latest thread or reply, nil if they never posted
+}
+
+// DirectoryFilter is a validated directory query
+type DirectoryFilter struct {
+	Search       string // substring of the name or email
+	RoleID       uint
+	Verified     *bool
+	JoinedFrom   *time.Time
+	JoinedTo     *time.Time
+	ActiveFrom   *time.Time
+	ActiveTo     *time.Time
+	Sort         string
+	Descending   bool
+	Limit        int
+	After        *directoryCursor
+	hiddenFilter string
+	hiddenArgs   []interface{}
+}
+
+// directoryCursor is the position after the last user on a page. It carries
+// the sort it was made for so it can't be replayed against another one.
+type directoryCursor struct {
+	Sort       string `json:"s"`
+	Descending bool   `json:"d"`
+	Value      string `json:"v"`
+	ID         uint   `json:"i"`
+}
+
+func (c directoryCursor) encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeDirectoryCursor(value string) (*directoryCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+	var cursor directoryCursor
+	if err := json.Unmarshal(data, &cursor); err != nil || cursor.ID == 0 {
+		return nil, errInvalidCursor
+	}
+	if _, ok := directorySorts[cursor.Sort]; !ok {
+		return nil, errInvalidCursor
+	}
+	return &cursor, nil
+}
+
+// cursorValue converts a cursor's value back to the sort column's type
+func (c directoryCursor) cursorValue() (interface{}, error) {
+	switch c.Sort {
+	case "name", "email":
+		return c.Value, nil
+	case "joined", "last_active":
+		t, err := time.Parse(time.RFC3339Nano, c.Value)
+		if err != nil {
+			return nil, errInvalidCursor
+		}
+		return t, nil
+	default:
+		n, err := strconv.ParseInt(c.Value, 10, 64)
+		if err != nil {
+			return nil, errInvalidCursor
+		}
+		return n, nil
+	}
+}
+
+// directoryRow is a user's position and activity in the directory
+type directoryRow struct {
+	ID          uint
+	LowerName   string // as lowercased by the database, so cursors compare exactly
+	LowerEmail  string
+	CreatedAt   time.Time
+	ThreadCount int64
+	ReplyCount  int64
+	LastActive  *time.Time
+}
+
+// sortValue is the value of the sort column for row, as stored in a cursor
+func (f *DirectoryFilter) sortValue(row directoryRow) string {
+	switch f.Sort {
+	case "name":
+		return row.LowerName
+	case "email":
+		return row.LowerEmail
+	case "joined":
+		return row.CreatedAt.UTC().Format(time.RFC3339Nano)
+	case "last_active":
+		if row.LastActive == nil {
+			return time.Unix(0, 0).UTC().Format(time.RFC3339Nano)
+		}
+		return row.LastActive.UTC().Format(time.RFC3339Nano)
+	case "threads":
+		return strconv.FormatInt(row.ThreadCount, 10)
+	default:
+		return strconv.FormatInt(row.ReplyCount, 10)
+	}
+}
+
+// ParseDirectoryFilter validates the directory's query parameters
+func ParseDirectoryFilter(query func(string) string) (*DirectoryFilter, error) {
+	filter := &DirectoryFilter{
+		Search: strings.TrimSpace(query("q")),
+		Sort:   "joined",
+		Limit:  directoryDefaultLimit,
+	}
+
+	if value := query("role_id"); value != "" {
+		id, err := strconv.ParseUint(value, 10, 32)
+		if err != nil || id == 0 {
+			return nil, fmt.Errorf("invalid role_id")
+		}
+		filter.RoleID = uint(id)
+	}
+	if value := query("verified"); value != "" {
+		verified, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("verified must be true or false")
+		}
+		filter.Verified = &verified
+	}
+
+	for _, param := range []struct {
+		name string
+		dest **time.Time
+	}{
+		{"joined_from", &filter.JoinedFrom},
+		{"joined_to", &filter.JoinedTo},
+		{"active_from", &filter.ActiveFrom},
+		{"active_to", &filter.ActiveTo},
+	} {
+		value := query(param.name)
+		if value == "" {
+			continue
+		}
+		t, err := parseDirectoryDate(value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s, use a date like 2025-01-31 or an RFC 3339 time", param.name)
+		}
+		*param.dest = &t
+	}
+
+	if value := query("sort"); value != "" {
+		if _, ok := directorySorts[value]; !ok {
+			return nil, fmt.Errorf("sort must be one of name, email, joined, last_active, threads or replies")
+		}
+		filter.Sort = value
+	}
+	switch query("order") {
+	case "", "desc":
+		// Newest, most active and biggest numbers first is the useful default,
+		// except for names and emails which read better A to Z
+		filter.Descending = query("order") == "desc" || (filter.Sort != "name" && filter.Sort != "email")
+	case "asc":
+		filter.Descending = false
+	default:
+		return nil, fmt.Errorf("order must be asc or desc")
+	}
+
+	if value := query("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > directoryMaxLimit {
+			return nil, fmt.Errorf("limit must be between 1 and %d", directoryMaxLimit)
+		}
+		filter.Limit = limit
+	}
+
+	if value := query("cursor"); value != "" {
+		cursor, err := decodeDirectoryCursor(value)
+		if err != nil {
+			return nil, err
+		}
+		if cursor.Sort != filter.Sort || cursor.Descending != filter.Descending {
+			return nil, fmt.Errorf("cursor was made for a different sort")
+		}
+		filter.After = cursor
+	}
+
+	return filter, nil
+}
+
+// parseDirectoryDate accepts a plain date or an RFC 3339 time
+func parseDirectoryDate(value string) (time.Time, error) {
+	if t, err := time.Parse("2006-01-02", value); err == nil {
+		return t, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// escapeLike stops % and _ in a search acting as wildcards
+func escapeLike(value string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(value)
+}
+
+// WithHiddenSections leaves threads and replies in sections the viewer
+// can't see out of the counts
+func (f *DirectoryFilter) WithHiddenSections(hidden []string) *DirectoryFilter {
+	f.hiddenFilter, f.hiddenArgs = hiddenSectionsFilter("threads.section", hidden)
+	return f
+}
+
+// directoryQuery selects users with their activity, filtered but not yet
+// paged or sorted
+func directoryQuery(db *gorm.DB, f *DirectoryFilter) *gorm.DB {
+	hiddenFilter, hiddenArgs := f.hiddenFilter, f.hiddenArgs
+	if hiddenFilter == "" {
+		hiddenFilter = "TRUE"
+	}
+
+	threads := db.Table("threads").
+		Select("user_id, COUNT(*) AS count, MAX(created_at) AS last").
+		Where("deleted_at IS NULL").
+		Where(hiddenFilter, hiddenArgs...).
+		Group("user_id")
+	replies := db.Table("replies").
+		Select("replies.user_id, COUNT(*) AS count, MAX(replies.created_at) AS last").
+		Joins("LEFT JOIN threads ON threads.id = replies.thread_id").
+		Where("replies.deleted_at IS NULL").
+		Where(hiddenFilter, hiddenArgs...).
+		Group("replies.user_id")
+
+	inner := db.Table("users").
+		Select(`users.id, users.name, users.email, users.created_at,
+            COALESCE(t.count, 0) AS thread_count,
+            COALESCE(r.count, 0) AS reply_count,
+            GREATEST(t.last, r.last) AS last_active`).
+		Joins("LEFT JOIN (?) AS t ON t.user_id = users.id", threads).
+		Joins("LEFT JOIN (?) AS r ON r.user_id = users.id", replies).
+		Where("users.deleted_at IS NULL AND users.anonymised_at IS NULL")
+
+	if f.Search != "" {
+		pattern := "%" + escapeLike(strings.ToLower(f.Search)) + "%"
+		inner = inner.Where("LOWER(users.name) LIKE ? OR LOWER(users.email) LIKE ?", pattern, pattern)
+	}
+	if f.RoleID != 0 {
+		inner = inner.Where("users.role_id = ?", f.RoleID)
+	}
+	if f.Verified != nil {
+		inner = inner.Where("users.verified = ?", *f.Verified)
+	}
+	if f.JoinedFrom != nil {
+		inner = inner.Where("users.created_at >= ?", *f.JoinedFrom)
+	}
+	if f.JoinedTo != nil {
+		inner = inner.Where("users.created_at < ?", *f.JoinedTo)
+	}
+
+	query := db.Table("(?) AS directory", inner)
+	if f.ActiveFrom != nil {
+		query = query.Where("directory.last_active >= ?", *f.ActiveFrom)
+	}
+	if f.ActiveTo != nil {
+		query = query.Where("directory.last_active < ?", *f.ActiveTo)
+	}
+	return query
+}
+
+// ListDirectory returns a page of users matching the filter, the total
+// number matching and the cursor for the next page, empty on the last one
+func ListDirectory(db *gorm.DB, f *DirectoryFilter) ([]DirectoryUser, int64, string, error) {
+	var total int64
+	if err := directoryQuery(db, f).Count(&total).Error; err != nil {
+		return nil, 0, "", err
+	}
+
+	sortColumn := directorySorts[f.Sort]
+	direction, comparison := "ASC", ">"
+	if f.Descending {
+		direction, comparison = "DESC", "<"
+	}
+
+	query := directoryQuery(db, f)
+	if f.After != nil {
+		value, err := f.After.cursorValue()
+		if err != nil {
+			return nil, 0, "", err
+		}
+		query = query.Where(fmt.Sprintf("(%s, directory.id) %s (?, ?)", sortColumn, comparison), value, f.After.ID)
+	}
+
+	var rows []directoryRow
+	// One extra row tells us whether there is another page
+	if err := query.
+		Select(`directory.id, LOWER(directory.name) AS lower_name, LOWER(directory.email) AS lower_email,
+            directory.created_at, directory.thread_count, directory.reply_count, directory.last_active`).
+		Order(fmt.Sprintf("%s %s, directory.id %s", sortColumn, direction, direction)).
+		Limit(f.Limit + 1).
+		Scan(&rows).Error; err != nil {
+		return nil, 0, "", err
+	}
+
+	hasMore := len(rows) > f.Limit
+	if hasMore {
+		rows = rows[:f.Limit]
+	}
+
+	ids := make([]uint, len(rows))
+	for i, row := range rows {
+		ids[i] = row.ID
+	}
+	var users []User
+	if len(ids) > 0 {
+		if err := db.Preload("Role").Where("id IN ?", ids).Find(&users).Error; err != nil {
+			return nil, 0, "", err
+		}
+	}
+	byID := make(map[uint]User, len(users))
+	for _, user := range users {
+		byID[user.ID] = user
+	}
+
+	result := make([]DirectoryUser, 0, len(rows))
+	for _, row := range rows {
+		result = append(result, DirectoryUser{
+			User:        byID[row.ID],
+			ThreadCount: row.ThreadCount,
+			ReplyCount:  row.ReplyCount,
+			LastActive:  row.LastActive,
+		})
+	}
+
+	nextCursor := ""
+	if hasMore && len(rows) > 0 {
+		last := rows[len(rows)-1]
+		nextCursor = directoryCursor{
+			Sort:       f.Sort,
+			Descending: f.Descending,
+			Value:      f.sortValue(last),
+			ID:         last.ID,
+		}.encode()
+	}
+	return result, total, nextCursor, nil
+}
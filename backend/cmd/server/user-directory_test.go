@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/base64"
+	"errors"
+	"net/url"
+	"testing"
+	"time"
+)
+
+func parseDirectoryQuery(t *testing.T, query string) (*DirectoryFilter, error) {
+	t.Helper()
+	values, err := url.ParseQuery(query)
+	if err != nil {
+		t.Fatalf("bad test query %q: %v", query, err)
+	}
+	return ParseDirectoryFilter(values.Get)
+}
+
+func TestParseDirectoryFilterDefaults(t *testing.T) {
+	filter, err := parseDirectoryQuery(t, "")
+	if err != nil {
+		t.Fatalf("ParseDirectoryFilter: %v", err)
+	}
+	if filter.Sort != "joined" || !filter.Descending || filter.Limit != directoryDefaultLimit || filter.After != nil {
+		t.Errorf("unexpected defaults %+v", filter)
+	}
+
+	// Names read A to Z unless asked otherwise
+	filter, err = parseDirectoryQuery(t, "sort=name")
+	if err != nil {
+		t.Fatalf("ParseDirectoryFilter: %v", err)
+	}
+	if filter.Descending {
+		t.Error("sort=name defaulted to descending")
+	}
+}
+
+func TestParseDirectoryFilterRejects(t *testing.T) {
+	for _, query := range []string{
+		"role_id=0",
+		"role_id=admin",
+		"verified=maybe",
+		"joined_from=31/01/2025",
+		"active_to=yesterday",
+		"sort=password",
+		"order=sideways",
+		"limit=0",
+		"limit=201",
+		"cursor=not-a-cursor",
+	} {
+		if _, err := parseDirectoryQuery(t, query); err == nil {
+			t.Errorf("%s accepted", query)
+		}
+	}
+}
+
+func TestDirectoryCursorRoundTrip(t *testing.T) {
+	joined := time.Date(2025, 1, 31, 12, 30, 0, 123456789, time.UTC)
+	tests := []struct {
+		sort string
+		row  directoryRow
+		want interface{}
+	}{
+		{"name", directoryRow{ID: 7, LowerName: "jane smith"}, "jane smith"},
+		{"email", directoryRow{ID: 7, LowerEmail: "jane@student.gla.ac.uk"}, "jane@student.gla.ac.uk"},
+		{"joined", directoryRow{ID: 7, CreatedAt: joined}, joined},
+		{"last_active", directoryRow{ID: 7}, time.Unix(0, 0).UTC()},
+		{"threads", directoryRow{ID: 7, ThreadCount: 42}, int64(42)},
+		{"replies", directoryRow{ID: 7, ReplyCount: 3}, int64(3)},
+	}
+	for _, tt := range tests {
+		filter := &DirectoryFilter{Sort: tt.sort, Descending: true}
+		encoded := directoryCursor{Sort: tt.sort, Descending: true, Value: filter.sortValue(tt.row), ID: tt.row.ID}.encode()
+
+		parsed, err := parseDirectoryQuery(t, "sort="+tt.sort+"&order=desc&cursor="+encoded)
+		if err != nil {
+			t.Fatalf("%s: cursor rejected: %v", tt.sort, err)
+		}
+		if parsed.After.ID != tt.row.ID {
+			t.Errorf("%s: cursor ID = %d, want %d", tt.sort, parsed.After.ID, tt.row.ID)
+		}
+		value, err := parsed.After.cursorValue()
+		if err != nil {
+			t.Fatalf("%s: cursorValue: %v", tt.sort, err)
+		}
+		if want, ok := tt.want.(time.Time); ok {
+			if !value.(time.Time).Equal(want) {
+				t.Errorf("%s: value = %v, want %v", tt.sort, value, want)
+			}
+		} else if value != tt.want {
+			t.Errorf("%s: value = %v, want %v", tt.sort, value, tt.want)
+		}
+	}
+}
+
+func TestDirectoryCursorMustMatchSort(t *testing.T) {
+	cursor := directoryCursor{Sort: "name", Descending: false, Value: "jane", ID: 7}.encode()
+
+	if _, err := parseDirectoryQuery(t, "sort=name&cursor="+cursor); err != nil {
+		t.Fatalf("cursor rejected for its own sort: %v", err)
+	}
+	for _, query := range []string{"sort=email", "sort=name&order=desc"} {
+		if _, err := parseDirectoryQuery(t, query+"&cursor="+cursor); err == nil {
+			t.Errorf("cursor accepted for %s", query)
+		}
+	}
+}
+
+func TestDecodeDirectoryCursorInvalid(t *testing.T) {
+	encode := func(s string) string { return base64.RawURLEncoding.EncodeToString([]byte(s)) }
+
+	for _, value := range []string{
+		"not base64!",
+		encode("not json"),
+		encode(`{"s":"name","v":"jane"}`),          // no ID
+		encode(`{"s":"password","v":"x","i":1}`),   // unknown sort
+		encode(`{"s":"threads","v":"lots","i":1}`), // value of the wrong type
+		encode(`{"s":"joined","v":"monday","i":1}`),
+	} {
+		cursor, err := decodeDirectoryCursor(value)
+		if err == nil {
+			_, err = cursor.cursorValue()
+		}
+		if !errors.Is(err, errInvalidCursor) {
+			t.Errorf("cursor %q: err = %v, want errInvalidCursor", value, err)
+		}
+	}
+}
+
+func TestEscapeLike(t *testing.T) {
+	if got := escapeLike(`50%_off\`); got != `50\%\_off\\` {
+		t.Errorf("escapeLike = %q", got)
+	}
+}
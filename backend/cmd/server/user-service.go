@@ -14,16 +14,24 @@ func NewUserService(db *gorm.DB) *UserService {
 	return &UserService{db: db}
 }
 
-func (s *UserService) GetUserActivityStats(userID uint, includePrivate bool) (*UserActivityStats, error) {
+// Activity queries take the sections the viewer can't see, so threads and
+// replies in them never show up in profiles or stats
+func (s *UserService) GetUserActivityStats(userID uint, includePrivate bool, hidden []string) (*UserActivityStats, error) {
 	stats := &UserActivityStats{
 		ActivityMap: make(map[string]int64),
 	}
+	threadFilter, threadArgs := hiddenSectionsFilter("section", hidden)
+	replyFilter, replyArgs := hiddenSectionsFilter("threads.section", hidden)
 
 	// Get base counts
-	if err := s.db.Model(&Thread{}).Where("user_id = ? AND deleted_at IS NULL", userID).Count(&stats.TotalThreads).Error; err != nil {
+	if err := s.db.Model(&Thread{}).Where("user_id = ? AND deleted_at IS NULL", userID).Where(threadFilter, threadArgs...).Count(&stats.TotalThreads).Error; err != nil {
 		return nil, err
 	}
-	if err := s.db.Model(&Reply{}).Where("user_id = ? AND deleted_at IS NULL", userID).Count(&stats.TotalReplies).Error; err != nil {
+	if err := s.db.Model(&Reply{}).
+		Joins("LEFT JOIN threads ON threads.id = replies.thread_id").
+		Where("replies.user_id = ? AND replies.deleted_at IS NULL", userID).
+		Where(replyFilter, replyArgs...).
+		Count(&stats.TotalReplies).Error; err != nil {
 		return nil, err
 	}
 
@@ -31,6 +39,7 @@ func (s *UserService) GetUserActivityStats(userID uint, includePrivate bool) (*U
 	if err := s.db.Model(&Thread{}).
 		Select("section, count(*) as count").
 		Where("user_id = ? AND deleted_at IS NULL", userID).
+		Where(threadFilter, threadArgs...).
 		Group("section").
 		Order("count desc").
 		Limit(5).
@@ -39,7 +48,7 @@ func (s *UserService) GetUserActivityStats(userID uint, includePrivate bool) (*U
 	}
 
 	// Get recent activity
-	recentActivity, err := s.getUserRecentActivity(userID)
+	recentActivity, err := s.getUserRecentActivity(userID, hidden)
 	if err != nil {
 		return nil, err
 	}
@@ -47,14 +56,14 @@ func (s *UserService) GetUserActivityStats(userID uint, includePrivate bool) (*U
 
 	// Include private metrics if requested
 	if includePrivate {
-		metrics, err := s.getUserEngagementMetrics(userID)
+		metrics, err := s.getUserEngagementMetrics(userID, hidden)
 		if err != nil {
 			return nil, err
 		}
 		stats.Metrics = *metrics
 
 		// Get activity map
-		activityMap, err := s.getActivityMap(userID)
+		activityMap, err := s.getActivityMap(userID, hidden)
 		if err != nil {
 			return nil, err
 		}
@@ -64,12 +73,15 @@ func (s *UserService) GetUserActivityStats(userID uint, includePrivate bool) (*U
 	return stats, nil
 }
 
-func (s *UserService) getUserRecentActivity(userID uint) (*UserRecentActivity, error) {
+func (s *UserService) getUserRecentActivity(userID uint, hidden []string) (*UserRecentActivity, error) {
 	activity := &UserRecentActivity{}
+	threadFilter, threadArgs := hiddenSectionsFilter("section", hidden)
+	replyFilter, replyArgs := hiddenSectionsFilter("threads.section", hidden)
 
 	// Get recent threads
 	if err := s.db.Model(&Thread{}).
 		Where("user_id = ? AND deleted_at IS NULL", userID).
+		Where(threadFilter, threadArgs...).
 		Order("created_at desc").
 		Limit(5).
 		Find(&activity.Threads).Error; err != nil {
@@ -81,6 +93,7 @@ func (s *UserService) getUserRecentActivity(userID uint) (*UserRecentActivity, e
 		Select("replies.id, replies.content, replies.thread_id, replies.created_at, threads.title as thread_title").
 		Joins("left join threads on threads.id = replies.thread_id").
 		Where("replies.user_id = ? AND replies.deleted_at IS NULL", userID).
+		Where(replyFilter, replyArgs...).
 		Order("replies.created_at desc").
 		Limit(5).
 		Scan(&activity.Replies).Error; err != nil {
@@ -90,10 +103,11 @@ func (s *UserService) getUserRecentActivity(userID uint) (*UserRecentActivity, e
 	return activity, nil
 }
 
-func (s *UserService) getUserEngagementMetrics(userID uint) (*UserEngagementMetrics, error) {
+func (s *UserService) getUserEngagementMetrics(userID uint, hidden []string) (*UserEngagementMetrics, error) {
 	metrics := &UserEngagementMetrics{
 		ActivityHeatmap: make(map[string]int64),
 	}
+	sectionFilter, sectionArgs := hiddenSectionsFilter("t.section", hidden)
 
 	// Calculate average response time
 	var totalTime float64
@@ -103,8 +117,8 @@ func (s *UserService) getUserEngagementMetrics(userID uint) (*UserEngagementMetr
         SELECT r.created_at, t.created_at as thread_created_at
         FROM replies r
         JOIN threads t ON t.id = r.thread_id
-        WHERE r.user_id = ? AND r.deleted_at IS NULL
-    `, userID).Rows()
+        WHERE r.user_id = ? AND r.deleted_at IS NULL AND `+sectionFilter+`
+    `, append([]interface{}{userID}, sectionArgs...)...).Rows()
 	if err != nil {
 		return nil, err
 	}
@@ -128,7 +142,7 @@ func (s *UserService) getUserEngagementMetrics(userID uint) (*UserEngagementMetr
 	}
 
 	// Get last active timestamp
-	lastActive, err := s.getLastActiveTime(userID)
+	lastActive, err := s.getLastActiveTime(userID, hidden)
 	if err != nil {
 		return nil, err
 	}
@@ -137,8 +151,10 @@ func (s *UserService) getUserEngagementMetrics(userID uint) (*UserEngagementMetr
 	return metrics, nil
 }
 
-func (s *UserService) getLastActiveTime(userID uint) (time.Time, error) {
+func (s *UserService) getLastActiveTime(userID uint, hidden []string) (time.Time, error) {
 	var lastActive time.Time
+	threadFilter, threadArgs := hiddenSectionsFilter("section", hidden)
+	replyFilter, replyArgs := hiddenSectionsFilter("threads.section", hidden)
 
 	// Get the most recent activity between threads and replies
 	err := s.db.Raw(`
@@ -146,39 +162,43 @@ func (s *UserService) getLastActiveTime(userID uint) (time.Time, error) {
             COALESCE((
                 SELECT created_at 
                 FROM threads 
-                WHERE user_id = ? AND deleted_at IS NULL 
+                WHERE user_id = ? AND deleted_at IS NULL AND `+threadFilter+`
                 ORDER BY created_at DESC 
                 LIMIT 1
             ), '1970-01-01'),
             COALESCE((
-                SELECT created_at 
+                SELECT replies.created_at 
                 FROM replies 
-                WHERE user_id = ? AND deleted_at IS NULL 
-                ORDER BY created_at DESC 
+                LEFT JOIN threads ON threads.id = replies.thread_id
+                WHERE replies.user_id = ? AND replies.deleted_at IS NULL AND `+replyFilter+`
+                ORDER BY replies.created_at DESC 
                 LIMIT 1
             ), '1970-01-01')
         ) as last_active
-    `, userID, userID).Scan(&lastActive).Error
+    `, sectionQueryArgs(userID, threadArgs, userID, replyArgs)...).Scan(&lastActive).Error
 
 	return lastActive, err
 }
 
-func (s *UserService) getActivityMap(userID uint) (map[string]int64, error) {
+func (s *UserService) getActivityMap(userID uint, hidden []string) (map[string]int64, error) {
 	activityMap := make(map[string]int64)
+	threadFilter, threadArgs := hiddenSectionsFilter("section", hidden)
+	replyFilter, replyArgs := hiddenSectionsFilter("threads.section", hidden)
 
 	// Get combined activity by month using SQL
 	rows, err := s.db.Raw(`
         SELECT DATE_TRUNC('month', activity_date) as month, COUNT(*) as count
         FROM (
             SELECT created_at as activity_date FROM threads 
-            WHERE user_id = ? AND deleted_at IS NULL
+            WHERE user_id = ? AND deleted_at IS NULL AND `+threadFilter+`
             UNION ALL
-            SELECT created_at FROM replies 
-            WHERE user_id = ? AND deleted_at IS NULL
+            SELECT replies.created_at FROM replies 
+            LEFT JOIN threads ON threads.id = replies.thread_id
+            WHERE replies.user_id = ? AND replies.deleted_at IS NULL AND `+replyFilter+`
         ) combined_activity
         GROUP BY DATE_TRUNC('month', activity_date)
         ORDER BY month DESC
-    `, userID, userID).Rows()
+    `, sectionQueryArgs(userID, threadArgs, userID, replyArgs)...).Rows()
 
 	if err != nil {
 		return nil, err
@@ -197,11 +217,13 @@ func (s *UserService) getActivityMap(userID uint) (map[string]int64, error) {
 	return activityMap, nil
 }
 
-func (s *UserService) GetUserActivity(userID uint, page, pageSize int) (*PaginatedActivity, error) {
+func (s *UserService) GetUserActivity(userID uint, page, pageSize int, hidden []string) (*PaginatedActivity, error) {
 	result := &PaginatedActivity{
 		Page:     page,
 		PageSize: pageSize,
 	}
+	threadFilter, threadArgs := hiddenSectionsFilter("section", hidden)
+	replyFilter, replyArgs := hiddenSectionsFilter("threads.section", hidden)
 
 	offset := (page - 1) * pageSize
 
@@ -210,11 +232,13 @@ func (s *UserService) GetUserActivity(userID uint, page, pageSize int) (*Paginat
 	err := s.db.Raw(`
         SELECT COUNT(*) 
         FROM (
-            SELECT id FROM threads WHERE user_id = ? AND deleted_at IS NULL
+            SELECT id FROM threads WHERE user_id = ? AND deleted_at IS NULL AND `+threadFilter+`
             UNION ALL
-            SELECT id FROM replies WHERE user_id = ? AND deleted_at IS NULL
+            SELECT replies.id FROM replies
+            LEFT JOIN threads ON threads.id = replies.thread_id
+            WHERE replies.user_id = ? AND replies.deleted_at IS NULL AND `+replyFilter+`
         ) combined_count
-    `, userID, userID).Count(&totalCount).Error
+    `, sectionQueryArgs(userID, threadArgs, userID, replyArgs)...).Count(&totalCount).Error
 
 	if err != nil {
 		return nil, err
@@ -233,7 +257,7 @@ func (s *UserService) GetUserActivity(userID uint, page, pageSize int) (*Paginat
                 created_at,
                 section
             FROM threads 
-            WHERE user_id = ? AND deleted_at IS NULL
+            WHERE user_id = ? AND deleted_at IS NULL AND `+threadFilter+`
             
             UNION ALL
             
@@ -247,11 +271,11 @@ func (s *UserService) GetUserActivity(userID uint, page, pageSize int) (*Paginat
                 NULL as section
             FROM replies 
             LEFT JOIN threads ON threads.id = replies.thread_id
-            WHERE replies.user_id = ? AND replies.deleted_at IS NULL
+            WHERE replies.user_id = ? AND replies.deleted_at IS NULL AND `+replyFilter+`
         ) combined_activity
         ORDER BY created_at DESC
         LIMIT ? OFFSET ?
-    `, userID, userID, pageSize, offset).Rows()
+    `, append(sectionQueryArgs(userID, threadArgs, userID, replyArgs), pageSize, offset)...).Rows()
 
 	if err != nil {
 		return nil, err
@@ -279,3 +303,11 @@ func (s *UserService) GetUserActivity(userID uint, page, pageSize int) (*Paginat
 	result.Activities = activities
 	return result, nil
 }
+
+// sectionQueryArgs orders the arguments for a query with a thread part and a
+// reply part, each a user ID followed by its hidden section filter's arguments
+func sectionQueryArgs(threadUserID uint, threadArgs []interface{}, replyUserID uint, replyArgs []interface{}) []interface{} {
+	args := append([]interface{}{threadUserID}, threadArgs...)
+	args = append(args, replyUserID)
+	return append(args, replyArgs...)
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"strconv"
@@ -35,47 +36,111 @@ ROLE LOGIC
 
 */
 
+// Built in roles, matching the ones seeded by db/init/01_init.sql. They are
+// recreated on startup if missing so can't be deleted or renamed.
+var defaultRoles = []Role{
+	{
+		Name:             "admin",
+		Color:            "#FF4444",
+		RequireTwoFactor: true,
+		Permissions: Permissions{
+			"can_manage_roles":   true,
+			"can_manage_users":   true,
+			"can_delete_threads": true,
+			"can_pin_threads":    true,
+			"can_suspend_users":  true,
+			"can_create_threads": true,
+			"can_reply":          true,
+		},
+	},
+	{
+		Name:  "moderator",
+		Color: "#44AA44",
+		Permissions: Permissions{
+			"can_delete_threads": true,
+			"can_pin_threads":    true,
+			"can_suspend_users":  true,
+			"can_create_threads": true,
+			"can_reply":          true,
+		},
+	},
+	{
+		// Staff and other non-student university addresses
+		Name:  "verified_member",
+		Color: "#4444FF",
+		Permissions: Permissions{
+			"can_create_threads": true,
+			"can_reply":          true,
+		},
+	},
+	{
+		Name:  "member",
+		Color: "#808080",
+		Permissions: Permissions{
+			"can_create_threads": true,
+			"can_reply":          true,
+		},
+	},
+	{
+		// Read only
+		Name:  "guest",
+		Color: "#A0A0A0",
+		Permissions: Permissions{
+			"can_create_threads": false,
+			"can_reply":          false,
+		},
+	},
+	{
+		// Members who have graduated and removed their student address
+		Name:  "alumni",
+		Color: "#B8860B",
+		Permissions: Permissions{
+			"can_create_threads": true,
+			"can_reply":          true,
+		},
+	},
+}
+
+func isDefaultRole(name string) bool {
+	for _, role := range defaultRoles {
+		if role.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
 // Initialize roles table and add default roles
 func initializeRoles(db *gorm.DB) error {
 	if err := db.AutoMigrate(&Role{}); err != nil {
 		return err
 	}
 
-	defaultRoles := []Role{
-		{
-			Name:  "admin",
-			Color: "#FF4444",
-			Permissions: Permissions{
-				"can_manage_roles":   true,
-				"can_manage_users":   true,
-				"can_delete_threads": true,
-				"can_pin_threads":    true,
-			},
-		},
-		{
-			Name:  "moderator",
-			Color: "#44AA44",
-			Permissions: Permissions{
-				"can_delete_threads": true,
-				"can_pin_threads":    true,
-			},
-		},
-		{
-			Name:  "member",
-			Color: "#808080",
-			Permissions: Permissions{
-				"can_create_threads": true,
-				"can_reply":          true,
-			},
-		},
-	}
-
 	for _, role := range defaultRoles {
 		var existingRole Role
 		if err := db.Where("name = ?", role.Name).First(&existingRole).Error; err != nil {
 			if err := db.Create(&role).Error; err != nil {
 				return err
 			}
+			continue
+		}
+
+		// Backfill permission keys added since the role was created, without
+		// overriding anything an admin has already set
+		if existingRole.Permissions == nil {
+			existingRole.Permissions = make(Permissions)
+		}
+		changed := false
+		for key, value := range role.Permissions {
+			if _, ok := existingRole.Permissions[key]; !ok {
+				existingRole.Permissions[key] = value
+				changed = true
+			}
+		}
+		if changed {
+			if err := db.Model(&existingRole).Update("permissions", existingRole.Permissions).Error; err != nil {
+				return err
+			}
 		}
 	}
 	return nil
@@ -115,22 +180,28 @@ func getCurrentUserProfile(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// Get full stats including private data
-		stats, err := userService.GetUserActivityStats(userID, true)
+		access, err := sectionAccess(c, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check section access"})
+			return
+		}
+		stats, err := userService.GetUserActivityStats(userID, true, access.HiddenSections())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user stats"})
 			return
 		}
 
 		c.JSON(http.StatusOK, gin.H{
-			"id":                  user.ID,
-			"name":                user.Name,
-			"email":               user.Email,
-			"role":                user.Role,
-			"bio":                 user.Bio,
-			"join_date":           user.CreatedAt,
-			"verified":            user.Verified,
-			"stats":               stats,
-			"profile_picture_url": user.ProfilePictureURL,
+			"id":                    user.ID,
+			"name":                  user.Name,
+			"email":                 user.Email,
+			"role":                  user.Role,
+			"bio":                   user.Bio,
+			"join_date":             user.CreatedAt,
+			"verified":              user.Verified,
+			"stats":                 stats,
+			"profile_picture_url":   user.ProfilePictureURL,
+			"deletion_scheduled_at": user.DeletionScheduledAt,
 		})
 	}
 }
@@ -152,8 +223,13 @@ func getPublicUserProfile(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		// Get public stats only
-		stats, err := userService.GetUserActivityStats(uid, false)
+		// Get public stats only, without sections the viewer can't see
+		access, err := sectionAccess(c, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check section access"})
+			return
+		}
+		stats, err := userService.GetUserActivityStats(uid, false, access.HiddenSections())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user stats"})
 			return
@@ -181,7 +257,12 @@ func getCurrentUserStats(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
-		stats, err := userService.GetUserActivityStats(userID, true)
+		access, err := sectionAccess(c, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check section access"})
+			return
+		}
+		stats, err := userService.GetUserActivityStats(userID, true, access.HiddenSections())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user stats"})
 			return
@@ -214,8 +295,14 @@ func getUserActivity(db *gorm.DB) gin.HandlerFunc {
 			pageSize = 10
 		}
 
-		// Get paginated activity
-		activity, err := userService.GetUserActivity(uid, page, pageSize)
+		access, err := sectionAccess(c, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check section access"})
+			return
+		}
+
+		// Get paginated activity, without sections the viewer can't see
+		activity, err := userService.GetUserActivity(uid, page, pageSize, access.HiddenSections())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user activity"})
 			return
@@ -264,12 +351,23 @@ func updateUserRole(db *gorm.DB) gin.HandlerFunc {
 			return
 		}
 
+		var target User
+		if err := db.Preload("Role").First(&target, userId).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
+			return
+		}
+
 		// Update user's role
 		if err := db.Model(&User{}).Where("id = ?", userId).Update("role_id", uint(roleID)).Error; err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to update user role"})
 			return
 		}
 
+		recordSecurityEvent(db, c, EventRoleChanged, target.ID, target.Email,
+			fmt.Sprintf("%s to %s by user %d", target.Role.Name, role.Name, getUserIdFromToken(c)))
+		recordAudit(db, c, AuditUserRoleChanged, AuditTargetUser, target.ID,
+			gin.H{"role_id": target.RoleID}, gin.H{"role_id": role.ID})
+
 		// Fetch updated user with role
 		var updatedUser User
 		if err := db.Preload("Role").First(&updatedUser, userId).Error; err != nil {
@@ -285,50 +383,65 @@ func updateUserRole(db *gorm.DB) gin.HandlerFunc {
 	}
 }
 
-func handleGetUsers(db *gorm.DB) gin.HandlerFunc {
+func clearUserLockout(db *gorm.DB, guard *LoginGuard) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		// Extract and validate JWT token
-		userID := getUserIdFromToken(c)
+		userId, err := strconv.Atoi(c.Param("userId"))
+		if err != nil || userId <= 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid user ID"})
+			return
+		}
 
-		// Fetch user with role information
-		var requestingUser User
-		if err := db.Preload("Role").Where("id = ?", userID).First(&requestingUser).Error; err != nil {
-			c.JSON(403, gin.H{"error": "Access denied"})
+		var user User
+		if err := db.First(&user, userId).Error; err != nil {
+			c.JSON(http.StatusNotFound, gin.H{"error": "User not found"})
 			return
 		}
 
-		// Check if user has admin role
-		if requestingUser.RoleID != 1 {
-			c.JSON(403, gin.H{"error": "Access denied"})
+		if err := guard.Unlock(user.Email); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to clear lockout"})
 			return
 		}
 
-		// Handle pagination
-		page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
-		pageSize, _ := strconv.Atoi(c.DefaultQuery("page_size", "10"))
-		offset := (page - 1) * pageSize
+		recordAudit(db, c, AuditUserLockoutCleared, AuditTargetUser, user.ID, nil, nil)
+
+		c.JSON(http.StatusOK, gin.H{"message": "Lockout cleared"})
+	}
+}
+
+// handleGetUsers is the admin user directory. See ParseDirectoryFilter for
+// the filters and sorts, pages are fetched by passing back next_cursor.
+func handleGetUsers(db *gorm.DB) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		filter, err := ParseDirectoryFilter(c.Query)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
 
-		// Fetch users with roles
-		var users []User
-		if err := db.Preload("Role").Offset(offset).Limit(pageSize).Find(&users).Error; err != nil {
-			c.JSON(500, gin.H{"error": "Failed to fetch users"})
+		access, err := sectionAccess(c, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check section access"})
 			return
 		}
+		filter.WithHiddenSections(access.HiddenSections())
 
-		// Total count for pagination
-		var total int64
-		if err := db.Model(&User{}).Count(&total).Error; err != nil {
-			c.JSON(500, gin.H{"error": "Failed to count users"})
+		users, total, nextCursor, err := ListDirectory(db, filter)
+		if err != nil {
+			if errors.Is(err, errInvalidCursor) {
+				c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid cursor"})
+				return
+			}
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch users"})
 			return
 		}
 
-		// Return users with pagination info
-		c.JSON(200, gin.H{
+		c.JSON(http.StatusOK, gin.H{
 			"users": users,
 			"pagination": gin.H{
-				"page":      page,
-				"page_size": pageSize,
-				"total":     total,
+				"limit":       filter.Limit,
+				"total":       total,
+				"next_cursor": nextCursor,
+				"has_more":    nextCursor != "",
 			},
 		})
 	}
@@ -375,7 +488,12 @@ func updateUserProfile(db *gorm.DB) gin.HandlerFunc {
 		}
 
 		// Get stats like in getCurrentUserProfile
-		stats, err := userService.GetUserActivityStats(userID, true)
+		access, err := sectionAccess(c, db)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to check section access"})
+			return
+		}
+		stats, err := userService.GetUserActivityStats(userID, true, access.HiddenSections())
 		if err != nil {
 			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch user stats"})
 			return
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+
+	"github.com/stefvuck/forum/internal/auth"
+	"github.com/stefvuck/forum/internal/mailer"
+)
+
+const verifyTokenLifetime = 48 * time.Hour
+
+// Minimum time between verification emails to the same account
+const verifyResendCooldown = 2 * time.Minute
+
+const resendVerificationMessage = "If an unverified account exists for that email, a new verification link has been sent."
+
+// newVerifyToken generates a verification token, returning the plaintext to
+// email and the hash to store
+func newVerifyToken() (string, string, error) {
+	token, err := auth.GenerateRandomToken()
+	if err != nil {
+		return "", "", err
+	}
+	return token, auth.HashToken(token), nil
+}
+
+func sendVerificationEmail(mail mailer.Mailer, config Config, user User, token string) {
+	if err := mailer.SendTemplate(mail, "verify_email", user.Email, gin.H{
+		"Name":      user.Name,
+		"Link":      verificationLink(config, token),
+		"ExpiresIn": "48 hours",
+	}); err != nil {
+		fmt.Println("Error sending verification email:", err)
+	}
+}
+
+func handleResendVerification(db *gorm.DB, config Config, mail mailer.Mailer) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		var input struct {
+			Email string `json:"email" binding:"required,email"`
+		}
+
+		if err := c.ShouldBindJSON(&input); err != nil {
+			c.JSON(400, gin.H{"error": err.Error()})
+			return
+		}
+
+		// Same response for unknown, verified and throttled accounts so this
+		// can't be used to probe who is registered
+		var user User
+		if err := db.Where("LOWER(email) = ? AND verified = ?", strings.ToLower(input.Email), false).
+			First(&user).Error; err != nil {
+			c.JSON(200, gin.H{"message": resendVerificationMessage})
+			return
+		}
+		if time.Since(user.VerifySentAt) < verifyResendCooldown {
+			c.JSON(200, gin.H{"message": resendVerificationMessage})
+			return
+		}
+
+		token, tokenHash, err := newVerifyToken()
+		if err != nil {
+			c.JSON(500, gin.H{"error": "Failed to generate verification token"})
+			return
+		}
+		// Replacing the hash invalidates any earlier link
+		if err := db.Model(&user).Updates(map[string]interface{}{
+			"verify_token":   tokenHash,
+			"verify_expires": time.Now().Add(verifyTokenLifetime),
+			"verify_sent_at": time.Now(),
+		}).Error; err != nil {
+			c.JSON(500, gin.H{"error": "Failed to generate verification token"})
+			return
+		}
+
+		go sendVerificationEmail(mail, config, user, token)
+
+		response := gin.H{"message": resendVerificationMessage}
+		if config.IsDev() {
+			response["verify_token"] = token
+		}
+		c.JSON(200, response)
+	}
+}
+
+// purgeUnverifiedUsers hard deletes accounts that were never verified and
+// were created before cutoff, freeing their email for a new registration
+func purgeUnverifiedUsers(db *gorm.DB, cutoff time.Time) (int64, error) {
+	result := db.Unscoped().
+		Where("verified = ? AND created_at < ?", false, cutoff).
+		Where("NOT EXISTS (SELECT 1 FROM threads WHERE threads.user_id = users.id)").
+		Where("NOT EXISTS (SELECT 1 FROM replies WHERE replies.user_id = users.id)").
+		Delete(&User{})
+	return result.RowsAffected, result.Error
+}
+
+func startUnverifiedPurge(db *gorm.DB, grace time.Duration) {
+	startBackgroundJob("unverified account purge", time.Hour, func() error {
+		purged, err := purgeUnverifiedUsers(db, time.Now().Add(-grace))
+		if purged > 0 {
+			fmt.Printf("Purged %d unverified accounts\n", purged)
+		}
+		return err
+	})
+}
+
+// hashLegacyVerifyTokens hashes verification tokens stored in plaintext
+// before tokens were hashed, so outstanding links keep working. Plaintext
+// tokens are 44 base64 characters, hashes are 64 hex characters.
+func hashLegacyVerifyTokens(db *gorm.DB) error {
+	return db.Exec(`
+        UPDATE users
+        SET verify_token = encode(sha256(convert_to(verify_token, 'UTF8')), 'hex')
+        WHERE verify_token IS NOT NULL AND verify_token <> '' AND length(verify_token) <> 64
+    `).Error
+}
@@ -179,11 +179,12 @@ ALTER TABLE ONLY public.threads ADD CONSTRAINT fk_users_threads FOREIGN KEY (use
 
 -- Insert default roles
 INSERT INTO public.roles (id, name, color, permissions, created_at, updated_at, deleted_at) VALUES
-(1, 'admin', '#FF4444', '{"can_pin_threads": true, "can_manage_roles": true, "can_manage_users": true, "can_delete_threads": true}', '2024-12-22 20:22:51.10418+00', '2024-12-22 20:22:51.10418+00', NULL),
-(2, 'moderator', '#44AA44', '{"can_pin_threads": true, "can_manage_users": false, "can_delete_threads": true}', '2024-12-22 20:22:51.10418+00', '2024-12-22 20:22:51.10418+00', NULL),
+(1, 'admin', '#FF4444', '{"can_reply": true, "can_pin_threads": true, "can_manage_roles": true, "can_manage_users": true, "can_create_threads": true, "can_delete_threads": true}', '2024-12-22 20:22:51.10418+00', '2024-12-22 20:22:51.10418+00', NULL),
+(2, 'moderator', '#44AA44', '{"can_reply": true, "can_pin_threads": true, "can_manage_users": false, "can_create_threads": true, "can_delete_threads": true}', '2024-12-22 20:22:51.10418+00', '2024-12-22 20:22:51.10418+00', NULL),
 (3, 'verified_member', '#4444FF', '{"can_reply": true, "can_create_threads": true}', '2024-12-22 20:22:51.10418+00', '2024-12-22 20:22:51.10418+00', NULL),
 (4, 'member', '#808080', '{"can_reply": true, "can_create_threads": true}', '2024-12-22 20:22:51.10418+00', '2024-12-22 20:22:51.10418+00', NULL),
-(5, 'guest', '#A0A0A0', '{"can_reply": false, "can_create_threads": false}', '2024-12-22 20:22:51.10418+00', '2024-12-22 20:22:51.10418+00', NULL);
+(5, 'guest', '#A0A0A0', '{"can_reply": false, "can_create_threads": false}', '2024-12-22 20:22:51.10418+00', '2024-12-22 20:22:51.10418+00', NULL),
+(6, 'alumni', '#B8860B', '{"can_reply": true, "can_create_threads": true}', '2024-12-22 20:22:51.10418+00', '2024-12-22 20:22:51.10418+00', NULL);
 
 -- Set sequence values
 SELECT pg_catalog.setval('public.replies_id_seq', 195, true);
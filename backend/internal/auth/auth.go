@@ -1,40 +1,106 @@
 package auth
 
 import (
-    "golang.org/x/crypto/bcrypt"
-    "github.com/golang-jwt/jwt/v5"
-    "time"
-//    "errors"
+	"errors"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
 )
 
-var JwtKey = []byte("your-secret-key") // In production, use environment variable
+// Access tokens are short lived, clients use their refresh token to get a new one
+const AccessTokenLifetime = 15 * time.Minute
+
+// Challenge tokens only prove the password step of a two factor login
+const ChallengeTokenLifetime = 5 * time.Minute
+
+// Token purposes, access tokens leave Purpose empty
+const PurposeTwoFactor = "2fa"
 
 type Claims struct {
-    UserID uint
-    Email  string
-    jwt.RegisteredClaims
+	UserID    uint
+	Email     string
+	SessionID uint
+	Purpose   string `json:",omitempty"`
+	jwt.RegisteredClaims
+}
+
+func GenerateToken(userID uint, email string, sessionID uint) (string, error) {
+	claims := &Claims{
+		UserID:    userID,
+		Email:     email,
+		SessionID: sessionID,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(AccessTokenLifetime)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return signClaims(claims)
 }
 
-func GenerateToken(userID uint, email string) (string, error) {
-    claims := &Claims{
-        UserID: userID,
-        Email:  email,
-        RegisteredClaims: jwt.RegisteredClaims{
-            ExpiresAt: jwt.NewNumericDate(time.Now().Add(24 * time.Hour)),
-            IssuedAt:  jwt.NewNumericDate(time.Now()),
-        },
-    }
-
-    token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-    return token.SignedString(JwtKey)
+func signClaims(claims *Claims) (string, error) {
+	kid, key, err := signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	token.Header["kid"] = kid
+	return token.SignedString(key)
 }
 
-func HashPassword(password string) (string, error) {
-    bytes, err := bcrypt.GenerateFromPassword([]byte(password), 14)
-    return string(bytes), err
+// GenerateChallengeToken issues a short lived token for the second login step
+func GenerateChallengeToken(userID uint, email string) (string, error) {
+	claims := &Claims{
+		UserID:  userID,
+		Email:   email,
+		Purpose: PurposeTwoFactor,
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ChallengeTokenLifetime)),
+			IssuedAt:  jwt.NewNumericDate(time.Now()),
+		},
+	}
+
+	return signClaims(claims)
 }
 
-func CheckPasswordHash(password, hash string) bool {
-    err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
-    return err == nil
-}
\ No newline at end of file
+// ParseChallengeToken validates a token issued by GenerateChallengeToken
+func ParseChallengeToken(tokenString string) (*Claims, error) {
+	claims, err := parseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != PurposeTwoFactor {
+		return nil, errors.New("not a challenge token")
+	}
+	return claims, nil
+}
+
+// ParseToken validates an access token and returns its claims
+func ParseToken(tokenString string) (*Claims, error) {
+	claims, err := parseClaims(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("not an access token")
+	}
+	return claims, nil
+}
+
+func parseClaims(tokenString string) (*Claims, error) {
+	claims := &Claims{}
+
+	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
+		kid, _ := token.Header["kid"].(string)
+		return verificationKey(kid)
+	}, jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}))
+	if err != nil {
+		return nil, err
+	}
+	if !token.Valid {
+		return nil, errors.New("invalid token")
+	}
+
+	return claims, nil
+}
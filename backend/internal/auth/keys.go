@@ -0,0 +1,72 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Tokens are signed with the active key and carry its ID in the "kid" header.
+// Retired keys stay in the set for verification only, so secrets can be
+// rotated without logging everyone out: add the new key as active, keep the
+// old one until the longest lived token signed with it has expired.
+var (
+	keysMu    sync.RWMutex
+	activeKID string
+	keys      = map[string][]byte{}
+)
+
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// SetKeys replaces the key set. activeKID must be present in keyset.
+func SetKeys(kid string, keyset map[string][]byte) error {
+	if kid == "" {
+		return errors.New("active key ID must not be empty")
+	}
+	active, ok := keyset[kid]
+	if !ok {
+		return fmt.Errorf("active key %q not in key set", kid)
+	}
+	if len(active) == 0 {
+		return fmt.Errorf("active key %q is empty", kid)
+	}
+
+	copied := make(map[string][]byte, len(keyset))
+	for id, key := range keyset {
+		if len(key) == 0 {
+			return fmt.Errorf("key %q is empty", id)
+		}
+		copied[id] = append([]byte(nil), key...)
+	}
+
+	keysMu.Lock()
+	defer keysMu.Unlock()
+	activeKID = kid
+	keys = copied
+	return nil
+}
+
+func signingKey() (string, []byte, error) {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	if activeKID == "" {
+		return "", nil, errors.New("signing keys not configured")
+	}
+	return activeKID, keys[activeKID], nil
+}
+
+// verificationKey returns the key for a token's kid. Tokens without one were
+// issued before key IDs and signed with what is still the active key, unless
+// it has been rotated since.
+func verificationKey(kid string) ([]byte, error) {
+	keysMu.RLock()
+	defer keysMu.RUnlock()
+	if kid == "" {
+		kid = activeKID
+	}
+	key, ok := keys[kid]
+	if !ok {
+		return nil, ErrUnknownKey
+	}
+	return key, nil
+}
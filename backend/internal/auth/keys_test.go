@@ -0,0 +1,130 @@
+package auth
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+func setTestKeys(t *testing.T, kid string, keyset map[string][]byte) {
+	t.Helper()
+	if err := SetKeys(kid, keyset); err != nil {
+		t.Fatalf("SetKeys: %v", err)
+	}
+}
+
+// signTestToken signs access token claims the way an older or forged token
+// might have been, kid is left out when empty
+func signTestToken(t *testing.T, method jwt.SigningMethod, kid string, key interface{}) string {
+	t.Helper()
+	claims := &Claims{
+		UserID: 1,
+		Email:  "jane@student.gla.ac.uk",
+		RegisteredClaims: jwt.RegisteredClaims{
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Minute)),
+		},
+	}
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header["kid"] = kid
+	}
+	signed, err := token.SignedString(key)
+	if err != nil {
+		t.Fatalf("SignedString: %v", err)
+	}
+	return signed
+}
+
+func TestSetKeysRejectsBadKeysets(t *testing.T) {
+	tests := []struct {
+		name   string
+		kid    string
+		keyset map[string][]byte
+	}{
+		{"empty active ID", "", map[string][]byte{"": []byte("secret")}},
+		{"active key missing", "new", map[string][]byte{"old": []byte("secret")}},
+		{"active key empty", "new", map[string][]byte{"new": {}}},
+		{"old key empty", "new", map[string][]byte{"new": []byte("secret"), "old": nil}},
+	}
+	for _, tt := range tests {
+		if err := SetKeys(tt.kid, tt.keyset); err == nil {
+			t.Errorf("%s: SetKeys accepted it", tt.name)
+		}
+	}
+}
+
+func TestKeyRotation(t *testing.T) {
+	setTestKeys(t, "old", map[string][]byte{"old": []byte("old-secret")})
+	oldToken, err := GenerateToken(1, "jane@student.gla.ac.uk", 5)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+
+	setTestKeys(t, "new", map[string][]byte{"new": []byte("new-secret"), "old": []byte("old-secret")})
+	newToken, err := GenerateToken(1, "jane@student.gla.ac.uk", 5)
+	if err != nil {
+		t.Fatalf("GenerateToken: %v", err)
+	}
+	parsed, _, err := jwt.NewParser().ParseUnverified(newToken, &Claims{})
+	if err != nil || parsed.Header["kid"] != "new" {
+		t.Errorf("new tokens signed with kid %v, want new", parsed.Header["kid"])
+	}
+
+	for name, token := range map[string]string{"old": oldToken, "new": newToken} {
+		claims, err := ParseToken(token)
+		if err != nil {
+			t.Errorf("%s key token rejected: %v", name, err)
+			continue
+		}
+		if claims.UserID != 1 || claims.SessionID != 5 {
+			t.Errorf("%s key token claims = %+v", name, claims)
+		}
+	}
+
+	// Once the old key is dropped its tokens stop working
+	setTestKeys(t, "new", map[string][]byte{"new": []byte("new-secret")})
+	if _, err := ParseToken(oldToken); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("token for a retired key: err = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestParseTokenUnknownKID(t *testing.T) {
+	setTestKeys(t, "new", map[string][]byte{"new": []byte("new-secret")})
+
+	// Signed with the right secret but claiming a key that isn't configured
+	token := signTestToken(t, jwt.SigningMethodHS256, "other", []byte("new-secret"))
+	if _, err := ParseToken(token); !errors.Is(err, ErrUnknownKey) {
+		t.Errorf("err = %v, want ErrUnknownKey", err)
+	}
+}
+
+func TestParseTokenMissingKIDUsesActiveKey(t *testing.T) {
+	setTestKeys(t, "new", map[string][]byte{"new": []byte("new-secret"), "old": []byte("old-secret")})
+
+	if _, err := ParseToken(signTestToken(t, jwt.SigningMethodHS256, "", []byte("new-secret"))); err != nil {
+		t.Errorf("token without kid signed by the active key rejected: %v", err)
+	}
+	if _, err := ParseToken(signTestToken(t, jwt.SigningMethodHS256, "", []byte("old-secret"))); err == nil {
+		t.Error("token without kid checked against a retired key")
+	}
+}
+
+func TestParseTokenRejectsOtherAlgorithms(t *testing.T) {
+	setTestKeys(t, "new", map[string][]byte{"new": []byte("new-secret")})
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"HS384", signTestToken(t, jwt.SigningMethodHS384, "new", []byte("new-secret"))},
+		{"HS512", signTestToken(t, jwt.SigningMethodHS512, "new", []byte("new-secret"))},
+		{"none", signTestToken(t, jwt.SigningMethodNone, "new", jwt.UnsafeAllowNoneSignatureType)},
+	}
+	for _, tt := range tests {
+		if _, err := ParseToken(tt.token); err == nil {
+			t.Errorf("%s token accepted", tt.name)
+		}
+	}
+}
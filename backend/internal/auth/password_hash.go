@@ -0,0 +1,169 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Password hash algorithms. Stored hashes say which one made them: bcrypt's
+// own "$2a$<cost>$..." prefix, or the PHC string format for argon2id
+// ("$argon2id$v=19$m=...,t=...,p=...$salt$hash"), so changing the settings
+// never breaks existing hashes, they are just upgraded on the next login.
+const (
+	HashBcrypt   = "bcrypt"
+	HashArgon2id = "argon2id"
+)
+
+const (
+	argon2SaltLen = 16
+	argon2KeyLen  = 32
+)
+
+// HashParams selects the algorithm and cost used for new password hashes
+type HashParams struct {
+	Algorithm     string
+	BcryptCost    int
+	Argon2Time    uint32
+	Argon2Memory  uint32 // in KiB
+	Argon2Threads uint8
+}
+
+func DefaultHashParams() HashParams {
+	return HashParams{
+		Algorithm:     HashBcrypt,
+		BcryptCost:    12,
+		Argon2Time:    3,
+		Argon2Memory:  64 * 1024,
+		Argon2Threads: 2,
+	}
+}
+
+var (
+	hashParamsMu sync.RWMutex
+	hashParams   = DefaultHashParams()
+)
+
+var ErrUnknownHashFormat = errors.New("unknown password hash format")
+
+// SetHashParams replaces the parameters used by HashPassword
+func SetHashParams(params HashParams) error {
+	switch params.Algorithm {
+	case HashBcrypt:
+		if params.BcryptCost < bcrypt.MinCost || params.BcryptCost > bcrypt.MaxCost {
+			return fmt.Errorf("bcrypt cost must be between %d and %d", bcrypt.MinCost, bcrypt.MaxCost)
+		}
+	case HashArgon2id:
+		if params.Argon2Time < 1 || params.Argon2Threads < 1 {
+			return errors.New("argon2id time and threads must be at least 1")
+		}
+		if params.Argon2Memory < 8*uint32(params.Argon2Threads) {
+			return errors.New("argon2id memory must be at least 8 KiB per thread")
+		}
+	default:
+		return fmt.Errorf("unknown password hash algorithm %q", params.Algorithm)
+	}
+
+	hashParamsMu.Lock()
+	defer hashParamsMu.Unlock()
+	hashParams = params
+	return nil
+}
+
+func currentHashParams() HashParams {
+	hashParamsMu.RLock()
+	defer hashParamsMu.RUnlock()
+	return hashParams
+}
+
+func HashPassword(password string) (string, error) {
+	params := currentHashParams()
+	if params.Algorithm == HashArgon2id {
+		return hashArgon2id(password, params)
+	}
+	bytes, err := bcrypt.GenerateFromPassword([]byte(password), params.BcryptCost)
+	return string(bytes), err
+}
+
+// CheckPasswordHash reports whether password matches hash and, if it does,
+// whether the hash was made with different settings than HashPassword now
+// uses and should be replaced
+func CheckPasswordHash(password, hash string) (ok bool, needsRehash bool) {
+	params := currentHashParams()
+
+	if strings.HasPrefix(hash, "$argon2id$") {
+		stored, salt, key, err := decodeArgon2id(hash)
+		if err != nil {
+			return false, false
+		}
+		computed := argon2.IDKey([]byte(password), salt, stored.Argon2Time, stored.Argon2Memory, stored.Argon2Threads, uint32(len(key)))
+		if subtle.ConstantTimeCompare(computed, key) != 1 {
+			return false, false
+		}
+		return true, params.Algorithm != HashArgon2id ||
+			stored.Argon2Time != params.Argon2Time ||
+			stored.Argon2Memory != params.Argon2Memory ||
+			stored.Argon2Threads != params.Argon2Threads
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		return false, false
+	}
+	cost, err := bcrypt.Cost([]byte(hash))
+	if err != nil {
+		return true, true
+	}
+	return true, params.Algorithm != HashBcrypt || cost != params.BcryptCost
+}
+
+func hashArgon2id(password string, params HashParams) (string, error) {
+	salt := make([]byte, argon2SaltLen)
+	if _, err := rand.Read(salt); err != nil {
+		return "", err
+	}
+	key := argon2.IDKey([]byte(password), salt, params.Argon2Time, params.Argon2Memory, params.Argon2Threads, argon2KeyLen)
+
+	return fmt.Sprintf("$argon2id$v=%d$m=%d,t=%d,p=%d$%s$%s",
+		argon2.Version, params.Argon2Memory, params.Argon2Time, params.Argon2Threads,
+		base64.RawStdEncoding.EncodeToString(salt),
+		base64.RawStdEncoding.EncodeToString(key),
+	), nil
+}
+
+func decodeArgon2id(hash string) (HashParams, []byte, []byte, error) {
+	var params HashParams
+
+	// "", "argon2id", "v=19", "m=...,t=...,p=...", salt, key
+	parts := strings.Split(hash, "$")
+	if len(parts) != 6 || parts[1] != HashArgon2id {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	var version int
+	if _, err := fmt.Sscanf(parts[2], "v=%d", &version); err != nil || version != argon2.Version {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	if _, err := fmt.Sscanf(parts[3], "m=%d,t=%d,p=%d", &params.Argon2Memory, &params.Argon2Time, &params.Argon2Threads); err != nil ||
+		params.Argon2Time < 1 || params.Argon2Threads < 1 {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	salt, err := base64.RawStdEncoding.DecodeString(parts[4])
+	if err != nil {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+	key, err := base64.RawStdEncoding.DecodeString(parts[5])
+	if err != nil || len(key) == 0 {
+		return params, nil, nil, ErrUnknownHashFormat
+	}
+
+	params.Algorithm = HashArgon2id
+	return params, salt, key, nil
+}
@@ -0,0 +1,107 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+)
+
+// Cheap settings so the tests run quickly
+var (
+	testBcrypt = HashParams{Algorithm: HashBcrypt, BcryptCost: 4}
+	testArgon  = HashParams{Algorithm: HashArgon2id, Argon2Time: 1, Argon2Memory: 64, Argon2Threads: 1}
+)
+
+func useHashParams(t *testing.T, params HashParams) {
+	t.Helper()
+	previous := currentHashParams()
+	if err := SetHashParams(params); err != nil {
+		t.Fatalf("SetHashParams: %v", err)
+	}
+	t.Cleanup(func() { SetHashParams(previous) })
+}
+
+func hashWith(t *testing.T, params HashParams, password string) string {
+	t.Helper()
+	useHashParams(t, params)
+	hash, err := HashPassword(password)
+	if err != nil {
+		t.Fatalf("HashPassword: %v", err)
+	}
+	return hash
+}
+
+func TestCheckPasswordHash(t *testing.T) {
+	for _, params := range []HashParams{testBcrypt, testArgon} {
+		hash := hashWith(t, params, "correct horse")
+
+		ok, needsRehash := CheckPasswordHash("correct horse", hash)
+		if !ok || needsRehash {
+			t.Errorf("%s: CheckPasswordHash = %v, %v, want true, false", params.Algorithm, ok, needsRehash)
+		}
+		if ok, _ := CheckPasswordHash("wrong horse", hash); ok {
+			t.Errorf("%s: wrong password accepted", params.Algorithm)
+		}
+	}
+}
+
+func TestArgon2idHashFormat(t *testing.T) {
+	hash := hashWith(t, testArgon, "correct horse")
+	if !strings.HasPrefix(hash, "$argon2id$v=19$m=64,t=1,p=1$") {
+		t.Errorf("unexpected hash format %q", hash)
+	}
+}
+
+func TestCheckPasswordHashRehash(t *testing.T) {
+	tests := []struct {
+		name        string
+		made, now   HashParams
+		needsRehash bool
+	}{
+		{"same bcrypt", testBcrypt, testBcrypt, false},
+		{"bcrypt cost raised", testBcrypt, HashParams{Algorithm: HashBcrypt, BcryptCost: 5}, true},
+		{"bcrypt to argon2id", testBcrypt, testArgon, true},
+		{"argon2id to bcrypt", testArgon, testBcrypt, true},
+		{"argon2id memory raised", testArgon, HashParams{Algorithm: HashArgon2id, Argon2Time: 1, Argon2Memory: 128, Argon2Threads: 1}, true},
+		{"argon2id time raised", testArgon, HashParams{Algorithm: HashArgon2id, Argon2Time: 2, Argon2Memory: 64, Argon2Threads: 1}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			hash := hashWith(t, tt.made, "correct horse")
+			useHashParams(t, tt.now)
+
+			ok, needsRehash := CheckPasswordHash("correct horse", hash)
+			if !ok {
+				t.Fatal("password rejected after settings changed")
+			}
+			if needsRehash != tt.needsRehash {
+				t.Errorf("needsRehash = %v, want %v", needsRehash, tt.needsRehash)
+			}
+			// A wrong password never asks for a rehash
+			if _, needsRehash := CheckPasswordHash("wrong horse", hash); needsRehash {
+				t.Error("wrong password asked for a rehash")
+			}
+		})
+	}
+}
+
+func TestCheckPasswordHashMalformed(t *testing.T) {
+	for _, hash := range []string{"", "plaintext", "$argon2id$v=19$broken", "$2a$04$short"} {
+		if ok, _ := CheckPasswordHash("anything", hash); ok {
+			t.Errorf("hash %q accepted", hash)
+		}
+	}
+}
+
+func TestSetHashParamsValidates(t *testing.T) {
+	for _, params := range []HashParams{
+		{Algorithm: "md5"},
+		{Algorithm: HashBcrypt, BcryptCost: 2},
+		{Algorithm: HashArgon2id, Argon2Time: 0, Argon2Memory: 64, Argon2Threads: 1},
+		{Algorithm: HashArgon2id, Argon2Time: 1, Argon2Memory: 4, Argon2Threads: 1},
+	} {
+		if err := SetHashParams(params); err == nil {
+			t.Errorf("SetHashParams(%+v) accepted", params)
+			SetHashParams(DefaultHashParams())
+		}
+	}
+}
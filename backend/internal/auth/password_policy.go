@@ -0,0 +1,236 @@
+package auth
+
+import (
+	"bufio"
+	"compress/gzip"
+	"embed"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Common and breached passwords, one lowercase entry per line. Kept offline
+// so checking a password never sends it anywhere. The built in list has
+// 7,320 entries, mostly from Mark Burnett's top 10,000 passwords as trimmed
+// by zxcvbn, see data/README.md. LoadCommonPasswordsFile adds a bigger one.
+//
+//go:embed data/common-passwords.txt.gz
+var commonPasswordFiles embed.FS
+
+var (
+	commonPasswordsOnce sync.Once
+	commonPasswords     map[string]struct{}
+)
+
+// Violation codes returned by PasswordPolicy.Check, stable for the frontend
+const (
+	PasswordTooShort       = "too_short"
+	PasswordTooLong        = "too_long"
+	PasswordRepeated       = "repeated_characters"
+	PasswordSimilarToUser  = "similar_to_user"
+	PasswordCommonPassword = "common_password"
+)
+
+// PasswordViolation is one reason a password was rejected
+type PasswordViolation struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// PasswordPolicy decides whether a new password is acceptable
+type PasswordPolicy struct {
+	MinLength   int // in characters
+	MaxLength   int // in bytes, bcrypt ignores anything past 72
+	MaxRepeat   int // longest run of one character
+	MinDistinct int // fewest different characters
+}
+
+func DefaultPasswordPolicy() PasswordPolicy {
+	return PasswordPolicy{
+		MinLength:   8,
+		MaxLength:   72,
+		MaxRepeat:   3,
+		MinDistinct: 4,
+	}
+}
+
+// Check returns every rule the password breaks, or nil if it is acceptable.
+// userInputs are things an attacker would try first, like the user's name
+// and email address.
+func (p PasswordPolicy) Check(password string, userInputs ...string) []PasswordViolation {
+	var violations []PasswordViolation
+
+	if n := utf8.RuneCountInString(password); n < p.MinLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooShort,
+			Message: fmt.Sprintf("Password must be at least %d characters", p.MinLength),
+		})
+	}
+	if p.MaxLength > 0 && len(password) > p.MaxLength {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordTooLong,
+			Message: fmt.Sprintf("Password must be at most %d bytes", p.MaxLength),
+		})
+	}
+
+	if longestRun(password) > p.MaxRepeat || distinctRunes(password) < p.MinDistinct {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordRepeated,
+			Message: "Password repeats the same characters too much",
+		})
+	}
+
+	if similarToInputs(password, userInputs) {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordSimilarToUser,
+			Message: "Password must not contain your name or email address",
+		})
+	}
+
+	if IsCommonPassword(password) {
+		violations = append(violations, PasswordViolation{
+			Code:    PasswordCommonPassword,
+			Message: "Password is too common and appears in known data breaches",
+		})
+	}
+
+	return violations
+}
+
+// IsCommonPassword reports whether the password, or the password with the
+// digits and symbols people tend to tack on the end removed, is on the list
+func IsCommonPassword(password string) bool {
+	commonPasswordsOnce.Do(loadCommonPasswords)
+
+	lower := strings.ToLower(password)
+	if _, ok := commonPasswords[lower]; ok {
+		return true
+	}
+	base := strings.TrimRightFunc(lower, func(r rune) bool {
+		return unicode.IsDigit(r) || unicode.IsPunct(r) || unicode.IsSymbol(r)
+	})
+	if len(base) < 4 || base == lower {
+		return false
+	}
+	_, ok := commonPasswords[base]
+	return ok
+}
+
+func loadCommonPasswords() {
+	commonPasswords = make(map[string]struct{})
+
+	f, err := commonPasswordFiles.Open("data/common-passwords.txt.gz")
+	if err != nil {
+		panic(err) // embedded, so only a broken build gets here
+	}
+	defer f.Close()
+
+	if _, err := readPasswordList(f, true); err != nil {
+		panic(err)
+	}
+}
+
+// LoadCommonPasswordsFile adds a password list, one per line and gzipped if
+// the name ends in .gz, on top of the built in one. Call it before serving,
+// the list isn't safe to change while passwords are being checked.
+func LoadCommonPasswordsFile(path string) (int, error) {
+	commonPasswordsOnce.Do(loadCommonPasswords)
+
+	f, err := os.Open(path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	return readPasswordList(f, strings.HasSuffix(path, ".gz"))
+}
+
+func readPasswordList(r io.Reader, gzipped bool) (int, error) {
+	if gzipped {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return 0, err
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	added := 0
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.ToLower(strings.TrimSpace(scanner.Text()))
+		if line == "" {
+			continue
+		}
+		if _, ok := commonPasswords[line]; !ok {
+			commonPasswords[line] = struct{}{}
+			added++
+		}
+	}
+	return added, scanner.Err()
+}
+
+func longestRun(s string) int {
+	longest, run := 0, 0
+	var prev rune
+	for i, r := range []rune(s) {
+		if i > 0 && unicode.ToLower(r) == unicode.ToLower(prev) {
+			run++
+		} else {
+			run = 1
+		}
+		if run > longest {
+			longest = run
+		}
+		prev = r
+	}
+	return longest
+}
+
+func distinctRunes(s string) int {
+	seen := make(map[rune]struct{})
+	for _, r := range strings.ToLower(s) {
+		seen[r] = struct{}{}
+	}
+	return len(seen)
+}
+
+// similarToInputs checks the password against each word of the user inputs,
+// splitting emails into their local part and domain labels
+func similarToInputs(password string, inputs []string) bool {
+	pw := alphanumeric(password)
+	if pw == "" {
+		return false
+	}
+
+	for _, input := range inputs {
+		words := strings.FieldsFunc(strings.ToLower(input), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+		})
+		// The whole input as well, so "John Smith" catches "johnsmith"
+		words = append(words, alphanumeric(input))
+
+		for _, word := range words {
+			if len(word) < 4 {
+				continue
+			}
+			if strings.Contains(pw, word) || strings.Contains(word, pw) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func alphanumeric(s string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(s) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,119 @@
+package auth
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func violationCodes(violations []PasswordViolation) []string {
+	codes := make([]string, len(violations))
+	for i, v := range violations {
+		codes[i] = v.Code
+	}
+	return codes
+}
+
+func TestPasswordPolicyCheck(t *testing.T) {
+	policy := DefaultPasswordPolicy()
+	inputs := []string{"Jane Smith", "jane.smith@student.gla.ac.uk"}
+
+	tests := []struct {
+		password string
+		want     []string
+	}{
+		{"quiet-Orbit-47-lantern", nil},
+		{"Qx7!p", []string{PasswordTooShort}},
+		{strings.Repeat("Qx7!", 19), []string{PasswordTooLong}},
+		{"Gh4aaaa!Xz9", []string{PasswordRepeated}},
+		{"abababababab", []string{PasswordRepeated}},
+		{"smithsonian-Q7!", []string{PasswordSimilarToUser}},
+		{"janesmith-Q7!x", []string{PasswordSimilarToUser}},
+		{"password", []string{PasswordCommonPassword}},
+		{"Password123!", []string{PasswordCommonPassword}},
+		{"qwerty", []string{PasswordTooShort, PasswordCommonPassword}},
+	}
+	for _, tt := range tests {
+		got := violationCodes(policy.Check(tt.password, inputs...))
+		if strings.Join(got, ",") != strings.Join(tt.want, ",") {
+			t.Errorf("Check(%q) = %v, want %v", tt.password, got, tt.want)
+		}
+	}
+}
+
+func TestPasswordPolicyShortInputsIgnored(t *testing.T) {
+	// Three letter names would otherwise rule out far too many passwords
+	if v := DefaultPasswordPolicy().Check("quiet-Orbit-47-lantern", "Ian", "ian@x.io"); v != nil {
+		t.Errorf("unexpected violations %v", violationCodes(v))
+	}
+}
+
+func TestIsCommonPassword(t *testing.T) {
+	for _, password := range []string{"password", "PASSWORD", "123456", "iloveyou", "letmein2024!"} {
+		if !IsCommonPassword(password) {
+			t.Errorf("%q not found on the list", password)
+		}
+	}
+	for _, password := range []string{"quiet-Orbit-47-lantern", "pas1"} {
+		if IsCommonPassword(password) {
+			t.Errorf("%q found on the list", password)
+		}
+	}
+}
+
+func TestLoadCommonPasswordsFile(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "extra.txt")
+	if err := os.WriteFile(plain, []byte("Zebra-Quokka-Tandem\n\npassword\n"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	zipped := filepath.Join(dir, "extra.txt.gz")
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	gz.Write([]byte("walrus-kettle-9921\n"))
+	gz.Close()
+	if err := os.WriteFile(zipped, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+
+	// "password" is already on the built in list so only one is new
+	if added, err := LoadCommonPasswordsFile(plain); err != nil || added != 1 {
+		t.Errorf("LoadCommonPasswordsFile(plain) = %d, %v, want 1", added, err)
+	}
+	if added, err := LoadCommonPasswordsFile(zipped); err != nil || added != 1 {
+		t.Errorf("LoadCommonPasswordsFile(gzipped) = %d, %v, want 1", added, err)
+	}
+	for _, password := range []string{"zebra-quokka-tandem", "Walrus-Kettle-9921"} {
+		if !IsCommonPassword(password) {
+			t.Errorf("%q from the extra list not found", password)
+		}
+	}
+
+	if _, err := LoadCommonPasswordsFile(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("missing file accepted")
+	}
+}
+
+// data/README.md gives the size of the built in list, keep it in step
+func TestBuiltInCommonPasswordsSize(t *testing.T) {
+	f, err := commonPasswordFiles.Open("data/common-passwords.txt.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	gz, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := io.ReadAll(gz)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n := strings.Count(string(data), "\n"); n != 7320 {
+		t.Errorf("built in list has %d entries, update data/README.md", n)
+	}
+}
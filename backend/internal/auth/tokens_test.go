@@ -0,0 +1,38 @@
+package auth
+
+import (
+	"encoding/base64"
+	"testing"
+)
+
+func TestGenerateRandomToken(t *testing.T) {
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		token, err := GenerateRandomToken()
+		if err != nil {
+			t.Fatalf("GenerateRandomToken: %v", err)
+		}
+		raw, err := base64.URLEncoding.DecodeString(token)
+		if err != nil {
+			t.Fatalf("token %q is not URL safe base64: %v", token, err)
+		}
+		if len(raw) != 32 {
+			t.Fatalf("token has %d bytes of entropy, want 32", len(raw))
+		}
+		if seen[token] {
+			t.Fatalf("token %q generated twice", token)
+		}
+		seen[token] = true
+	}
+}
+
+func TestHashToken(t *testing.T) {
+	// sha256("abc")
+	const want = "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"
+	if got := HashToken("abc"); got != want {
+		t.Errorf("HashToken(abc) = %s, want %s", got, want)
+	}
+	if HashToken("abc") == HashToken("abd") {
+		t.Error("different tokens hashed the same")
+	}
+}
@@ -0,0 +1,101 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// The RFC 6238 SHA-1 test secret, "12345678901234567890" in base32
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestValidateTOTPVectors(t *testing.T) {
+	// RFC 6238 appendix B, truncated to six digits
+	tests := []struct {
+		unix int64
+		code string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+	}
+	for _, tt := range tests {
+		step, ok := ValidateTOTP(rfcSecret, tt.code, time.Unix(tt.unix, 0), 0)
+		if !ok {
+			t.Errorf("code %s at %d rejected", tt.code, tt.unix)
+			continue
+		}
+		if step != tt.unix/totpPeriod {
+			t.Errorf("code %s matched step %d, want %d", tt.code, step, tt.unix/totpPeriod)
+		}
+	}
+}
+
+func TestValidateTOTPRejectsReplay(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+
+	step, ok := ValidateTOTP(rfcSecret, "081804", now, 0)
+	if !ok {
+		t.Fatal("valid code rejected")
+	}
+	if _, ok := ValidateTOTP(rfcSecret, "081804", now, step); ok {
+		t.Error("code accepted again after its step was used")
+	}
+	// A later code is still fine after an earlier one was used
+	next := totpCode([]byte("12345678901234567890"), step+1)
+	if _, ok := ValidateTOTP(rfcSecret, next, now.Add(totpPeriod*time.Second), step); !ok {
+		t.Error("next step's code rejected")
+	}
+}
+
+func TestValidateTOTPSkew(t *testing.T) {
+	now := time.Unix(1111111109, 0)
+	key := []byte("12345678901234567890")
+	current := now.Unix() / totpPeriod
+
+	for _, offset := range []int64{-1, 1} {
+		if _, ok := ValidateTOTP(rfcSecret, totpCode(key, current+offset), now, 0); !ok {
+			t.Errorf("code %d steps away rejected", offset)
+		}
+	}
+	for _, offset := range []int64{-2, 2} {
+		if _, ok := ValidateTOTP(rfcSecret, totpCode(key, current+offset), now, 0); ok {
+			t.Errorf("code %d steps away accepted", offset)
+		}
+	}
+}
+
+func TestValidateTOTPMalformed(t *testing.T) {
+	now := time.Unix(59, 0)
+	for _, code := range []string{"", "28708", "2870822", "abcdef"} {
+		if _, ok := ValidateTOTP(rfcSecret, code, now, 0); ok {
+			t.Errorf("code %q accepted", code)
+		}
+	}
+	if _, ok := ValidateTOTP("not base32!", "287082", now, 0); ok {
+		t.Error("invalid secret accepted")
+	}
+	if _, ok := ValidateTOTP(rfcSecret, " 287 082 ", now, 0); !ok {
+		t.Error("code with spaces rejected")
+	}
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	if err != nil {
+		t.Fatalf("GenerateRecoveryCodes: %v", err)
+	}
+	if len(codes) != 10 {
+		t.Fatalf("got %d codes, want 10", len(codes))
+	}
+	for _, code := range codes {
+		if len(code) != 11 || code[5] != '-' {
+			t.Errorf("code %q is not formatted xxxxx-xxxxx", code)
+		}
+		loose := strings.ToUpper(strings.ReplaceAll(code, "-", ""))
+		if NormalizeRecoveryCode(" "+loose+" ") != code {
+			t.Errorf("NormalizeRecoveryCode(%q) != %q", loose, code)
+		}
+	}
+}
@@ -0,0 +1,67 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+//go:embed templates/*.tmpl
+var templateFS embed.FS
+
+// Message is a single outgoing email with plain text and HTML bodies
+type Message struct {
+	To      string
+	Subject string
+	Text    string
+	HTML    string
+}
+
+// Mailer is implemented by anything that can deliver a Message
+type Mailer interface {
+	Send(msg Message) error
+}
+
+// Render builds a Message from one of the embedded templates. Each template
+// file defines a "subject", "text" and "html" block.
+func Render(name, to string, data interface{}) (Message, error) {
+	file := "templates/" + name + ".tmpl"
+
+	textTmpl, err := texttemplate.ParseFS(templateFS, file)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to parse email template %q: %w", name, err)
+	}
+	htmlTmpl, err := htmltemplate.ParseFS(templateFS, file)
+	if err != nil {
+		return Message{}, fmt.Errorf("failed to parse email template %q: %w", name, err)
+	}
+
+	var subject, text, html bytes.Buffer
+	if err := textTmpl.ExecuteTemplate(&subject, "subject", data); err != nil {
+		return Message{}, err
+	}
+	if err := textTmpl.ExecuteTemplate(&text, "text", data); err != nil {
+		return Message{}, err
+	}
+	if err := htmlTmpl.ExecuteTemplate(&html, "html", data); err != nil {
+		return Message{}, err
+	}
+
+	return Message{
+		To:      to,
+		Subject: subject.String(),
+		Text:    text.String(),
+		HTML:    html.String(),
+	}, nil
+}
+
+// SendTemplate renders the named template and sends it through m
+func SendTemplate(m Mailer, name, to string, data interface{}) error {
+	msg, err := Render(name, to, data)
+	if err != nil {
+		return err
+	}
+	return m.Send(msg)
+}
@@ -0,0 +1,47 @@
+package mailer
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestMemoryMailerRecordsMessages(t *testing.T) {
+	m := NewMemoryMailer()
+	if _, ok := m.Last(); ok {
+		t.Fatal("Last on an empty mailer returned a message")
+	}
+
+	err := SendTemplate(m, "verify_email", "someone@student.gla.ac.uk", map[string]string{
+		"Name":      "Someone",
+		"Link":      "http://localhost:5173/verify?token=abc",
+		"ExpiresIn": "24 hours",
+	})
+	if err != nil {
+		t.Fatalf("SendTemplate: %v", err)
+	}
+
+	msg, ok := m.Last()
+	if !ok {
+		t.Fatal("no message recorded")
+	}
+	if msg.To != "someone@student.gla.ac.uk" {
+		t.Errorf("To = %q", msg.To)
+	}
+	if msg.Subject == "" {
+		t.Error("subject is empty")
+	}
+	if !strings.Contains(msg.Text, "verify?token=abc") || !strings.Contains(msg.HTML, "verify?token=abc") {
+		t.Error("link missing from the text or HTML body")
+	}
+
+	m.Reset()
+	if len(m.Messages()) != 0 {
+		t.Error("Reset left messages behind")
+	}
+}
+
+func TestRenderUnknownTemplate(t *testing.T) {
+	if _, err := Render("does_not_exist", "a@b.c", nil); err == nil {
+		t.Fatal("expected an error for a missing template")
+	}
+}
@@ -0,0 +1,108 @@
+package mailer
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+// fakeSMTPServer accepts one message and returns the MAIL FROM argument and
+// the message data through the channels
+func fakeSMTPServer(t *testing.T) (string, <-chan string, <-chan string) {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	mailFrom := make(chan string, 1)
+	data := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+		r := bufio.NewReader(conn)
+		reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+
+		reply("220 fake ESMTP")
+		for {
+			line, err := r.ReadString('\n')
+			if err != nil {
+				return
+			}
+			line = strings.TrimRight(line, "\r\n")
+			command := strings.ToUpper(line)
+			switch {
+			case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+				reply("250 fake")
+			case strings.HasPrefix(command, "MAIL FROM:"):
+				mailFrom <- line[len("MAIL FROM:"):]
+				reply("250 OK")
+			case strings.HasPrefix(command, "RCPT TO:"):
+				reply("250 OK")
+			case command == "DATA":
+				reply("354 Go ahead")
+				var body strings.Builder
+				for {
+					dataLine, err := r.ReadString('\n')
+					if err != nil {
+						return
+					}
+					if dataLine == ".\r\n" {
+						break
+					}
+					body.WriteString(dataLine)
+				}
+				data <- body.String()
+				reply("250 OK")
+			case command == "QUIT":
+				reply("221 Bye")
+				return
+			default:
+				reply("502 Not implemented")
+			}
+		}
+	}()
+
+	return listener.Addr().String(), mailFrom, data
+}
+
+func TestSMTPMailerDisplayNameSender(t *testing.T) {
+	addr, mailFrom, data := fakeSMTPServer(t)
+	host, port, _ := net.SplitHostPort(addr)
+
+	m := NewSMTPMailer(host, port, "", "", "GU Drones Forum <noreply@gudrones.com>")
+	err := m.Send(Message{To: "someone@student.gla.ac.uk", Subject: "Hello", Text: "Hi", HTML: "<p>Hi</p>"})
+	if err != nil {
+		t.Fatalf("Send: %v", err)
+	}
+
+	if got := <-mailFrom; got != "<noreply@gudrones.com>" {
+		t.Errorf("MAIL FROM:%s, want the bare address", got)
+	}
+	if body := <-data; !strings.Contains(body, "From: GU Drones Forum <noreply@gudrones.com>\r\n") {
+		t.Errorf("From header lost the display name:\n%s", body)
+	}
+}
+
+func TestEnvelopeAddress(t *testing.T) {
+	tests := []struct {
+		from, want string
+		ok         bool
+	}{
+		{"GU Drones Forum <noreply@gudrones.com>", "noreply@gudrones.com", true},
+		{"noreply@gudrones.com", "noreply@gudrones.com", true},
+		{"GU Drones Forum", "", false},
+		{"", "", false},
+	}
+	for _, tt := range tests {
+		got, err := EnvelopeAddress(tt.from)
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("EnvelopeAddress(%q) = %q, %v", tt.from, got, err)
+		}
+	}
+}
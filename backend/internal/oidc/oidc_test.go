@@ -0,0 +1,144 @@
+package oidc_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stefvuck/forum/internal/oidc"
+	"github.com/stefvuck/forum/internal/oidc/mockidp"
+)
+
+const (
+	testClientID    = "forum"
+	testRedirectURL = "http://forum.test/api/auth/oidc/callback"
+)
+
+// startMockIDP runs the mock provider and returns a relying party for it
+func startMockIDP(t *testing.T) *oidc.Provider {
+	t.Helper()
+
+	// The issuer has to be the server's own URL, which isn't known until it starts
+	var handler http.Handler
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+
+	idp, err := mockidp.New(server.URL, testClientID)
+	if err != nil {
+		t.Fatalf("mockidp.New: %v", err)
+	}
+	handler = idp.Handler()
+
+	return oidc.NewProvider(oidc.Config{
+		Issuer:      server.URL,
+		ClientID:    testClientID,
+		RedirectURL: testRedirectURL,
+	}, server.Client())
+}
+
+// authorize follows the login URL like a browser would, with login_hint
+// standing in for the user filling in the provider's form, and returns the
+// code and state sent back to the redirect URL
+func authorize(t *testing.T, provider *oidc.Provider, state, nonce, verifier, email string) (string, string) {
+	t.Helper()
+
+	authURL, err := provider.AuthCodeURL(context.Background(), state, nonce, verifier)
+	if err != nil {
+		t.Fatalf("AuthCodeURL: %v", err)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	resp, err := client.Get(authURL + "&login_hint=" + url.QueryEscape(email))
+	if err != nil {
+		t.Fatalf("authorize request: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize returned %d, want a redirect", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("bad redirect: %v", err)
+	}
+	if !strings.HasPrefix(location.String(), testRedirectURL+"?") {
+		t.Fatalf("redirected to %s, want %s", location, testRedirectURL)
+	}
+	return location.Query().Get("code"), location.Query().Get("state")
+}
+
+func randomStrings(t *testing.T, n int) []string {
+	t.Helper()
+	values := make([]string, n)
+	for i := range values {
+		value, err := oidc.RandomString()
+		if err != nil {
+			t.Fatalf("RandomString: %v", err)
+		}
+		values[i] = value
+	}
+	return values
+}
+
+func TestAuthorizationCodeFlowWithPKCE(t *testing.T) {
+	provider := startMockIDP(t)
+	values := randomStrings(t, 3)
+	state, nonce, verifier := values[0], values[1], values[2]
+
+	code, returnedState := authorize(t, provider, state, nonce, verifier, "Jane.Smith@student.gla.ac.uk")
+	if code == "" {
+		t.Fatal("no code in the redirect")
+	}
+	if returnedState != state {
+		t.Errorf("state = %q, want %q", returnedState, state)
+	}
+
+	claims, err := provider.Exchange(context.Background(), code, verifier, nonce)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+	if claims.Email != "Jane.Smith@student.gla.ac.uk" || !claims.EmailVerified {
+		t.Errorf("email = %q verified = %v", claims.Email, claims.EmailVerified)
+	}
+	if claims.Subject != "mock|jane.smith@student.gla.ac.uk" {
+		t.Errorf("subject = %q", claims.Subject)
+	}
+	if claims.Nonce != nonce {
+		t.Errorf("nonce = %q, want %q", claims.Nonce, nonce)
+	}
+
+	// Codes are single use
+	if _, err := provider.Exchange(context.Background(), code, verifier, nonce); err == nil {
+		t.Error("code redeemed twice")
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	provider := startMockIDP(t)
+	values := randomStrings(t, 4)
+	state, nonce, verifier, otherVerifier := values[0], values[1], values[2], values[3]
+
+	// Someone who intercepted the code doesn't have the verifier
+	code, _ := authorize(t, provider, state, nonce, verifier, "jane@student.gla.ac.uk")
+	if _, err := provider.Exchange(context.Background(), code, otherVerifier, nonce); err == nil {
+		t.Error("code redeemed with the wrong PKCE verifier")
+	}
+}
+
+func TestExchangeRejectsWrongNonce(t *testing.T) {
+	provider := startMockIDP(t)
+	values := randomStrings(t, 4)
+	state, nonce, verifier, otherNonce := values[0], values[1], values[2], values[3]
+
+	code, _ := authorize(t, provider, state, nonce, verifier, "jane@student.gla.ac.uk")
+	if _, err := provider.Exchange(context.Background(), code, verifier, otherNonce); err == nil {
+		t.Error("ID token accepted with the wrong nonce")
+	}
+}
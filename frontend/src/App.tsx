@@ -13,6 +13,8 @@ import { PublicProfilePage } from './components/forum/PublicProfilePage';
 import { RequireAuth } from './components/auth/RequireAuth';
 import { AdminRolesPage } from './components/forum/AdminRolesPage';
 import { NotFound } from './components/layout/NotFound';
+import { ResetPasswordPage } from './components/auth/ResetPasswordPage';
+import { OidcCallbackPage } from './components/auth/OidcCallbackPage';
 
 
 function App() {
@@ -142,37 +144,30 @@ function App() {
   return (
     <AuthProvider>
       <Router>
-        <div className="flex h-screen w-screen bg-gray-100">
-          <RequireAuth>
-          <Sidebar 
-            currentSection={currentSection}
-            onSectionChange={handleSectionChange}
-          />
-          <div className="flex-1 flex flex-col h-full">
-          <ForumHeader
-            totalThreads={searchResults ? searchResults.length : threads.length}
-            currentSection={currentSection}
-            onSearch={handleSearch}
-            isSearchActive={!!searchResults}
-            onClearSearch={() => setSearchResults(null)}
-            setIsCreateModalOpen={setIsCreateModalOpen}
-          />
-            <main className="flex-1 h-full p-8 overflow-auto">
-            <Routes>
-              <Route path="/" element={
-                <ThreadList 
-                  threads={searchResults || threads}
-                  isLoading={isLoading}
-                  onThreadClick={handleThreadClick}
-                  setIsCreateModalOpen={setIsCreateModalOpen}
-                  authToken={authToken}
-                />
-              } />
-              {sections.map(section => (
-                <Route 
-                  key={section.id} 
-                  path={`/${section.id}`} 
-                  element={
+        <Routes>
+          {/* Opened from emails by people who aren't logged in */}
+          <Route path="/reset-password" element={<ResetPasswordPage />} />
+          {/* Where single sign-on lands after the identity provider */}
+          <Route path="/oidc/callback" element={<OidcCallbackPage />} />
+          <Route path="*" element={
+            <div className="flex h-screen w-screen bg-gray-100">
+              <RequireAuth>
+              <Sidebar 
+                currentSection={currentSection}
+                onSectionChange={handleSectionChange}
+              />
+              <div className="flex-1 flex flex-col h-full">
+              <ForumHeader
+                totalThreads={searchResults ? searchResults.length : threads.length}
+                currentSection={currentSection}
+                onSearch={handleSearch}
+                isSearchActive={!!searchResults}
+                onClearSearch={() => setSearchResults(null)}
+                setIsCreateModalOpen={setIsCreateModalOpen}
+              />
+                <main className="flex-1 h-full p-8 overflow-auto">
+                <Routes>
+                  <Route path="/" element={
                     <ThreadList 
                       threads={searchResults || threads}
                       isLoading={isLoading}
@@ -180,58 +175,73 @@ function App() {
                       setIsCreateModalOpen={setIsCreateModalOpen}
                       authToken={authToken}
                     />
-                  }
-                />
-              ))}
-              <Route 
-                path="/thread/:id" 
-                element={
-                  <RequireAuth>
-                    <ThreadViewWrapper />
-                  </RequireAuth>
-                } 
-              />
-
-              <Route 
-                path="/profile" 
-                element={
-                  <RequireAuth>
-                    <ProfilePage />
-                  </RequireAuth>
-                } 
-              />
-
-              <Route 
-                path="/users/:userId" 
-                element={
-                  <RequireAuth>
-                    <PublicProfilePage />
-                  </RequireAuth>
-                } 
-              />
-              <Route 
-                path="/admin/roles" 
-                element={
-                  <RequireAuth roles={['admin']}>
-                    <AdminRolesPage />
-                  </RequireAuth>
-                } 
-              />
-
-              <Route path="*" element={<NotFound />} />
-            </Routes>
-
-              {isCreateModalOpen && (
-                <CreateThreadModal
-                  section={currentSection}
-                  onClose={() => setIsCreateModalOpen(false)}
-                  onThreadCreated={handleThreadCreated}
-                />
-              )}
-            </main>
-          </div>
-          </RequireAuth>
-        </div>
+                  } />
+                  {sections.map(section => (
+                    <Route 
+                      key={section.id} 
+                      path={`/${section.id}`} 
+                      element={
+                        <ThreadList 
+                          threads={searchResults || threads}
+                          isLoading={isLoading}
+                          onThreadClick={handleThreadClick}
+                          setIsCreateModalOpen={setIsCreateModalOpen}
+                          authToken={authToken}
+                        />
+                      }
+                    />
+                  ))}
+                  <Route 
+                    path="/thread/:id" 
+                    element={
+                      <RequireAuth>
+                        <ThreadViewWrapper />
+                      </RequireAuth>
+                    } 
+                  />
+
+                  <Route 
+                    path="/profile" 
+                    element={
+                      <RequireAuth>
+                        <ProfilePage />
+                      </RequireAuth>
+                    } 
+                  />
+
+                  <Route 
+                    path="/users/:userId" 
+                    element={
+                      <RequireAuth>
+                        <PublicProfilePage />
+                      </RequireAuth>
+                    } 
+                  />
+                  <Route 
+                    path="/admin/roles" 
+                    element={
+                      <RequireAuth roles={['admin']}>
+                        <AdminRolesPage />
+                      </RequireAuth>
+                    } 
+                  />
+
+                  <Route path="*" element={<NotFound />} />
+                </Routes>
+
+                  {isCreateModalOpen && (
+                    <CreateThreadModal
+                      section={currentSection}
+                      onClose={() => setIsCreateModalOpen(false)}
+                      onThreadCreated={handleThreadCreated}
+                    />
+                  )}
+                </main>
+              </div>
+              </RequireAuth>
+            </div>
+          } />
+        </Routes>
       </Router>
     </AuthProvider>
   );
@@ -1,23 +1,57 @@
-import React, { useState } from 'react';
-import { X, Check, Mail } from 'lucide-react';
+import React, { useEffect, useState } from 'react';
+import { X, Check, Mail, ShieldCheck } from 'lucide-react';
 import { useAuth } from '../../context/AuthContext';
+import { api } from '../../services/api';
+import type { LoginResponse, TwoFactorChallenge, TwoFactorSetup } from '../../services/api';
 
 type AuthModalProps = {
   onClose: () => void;
+  challenge?: TwoFactorChallenge; // Start at the second step, after single sign-on
 };
 
-type ModalState = 'login' | 'register' | 'verify' | 'verification-needed';
+type ModalState = 'login' | 'register' | 'verify' | 'verification-needed' | 'forgot'
+  | 'two-factor' | 'two-factor-setup' | 'recovery-codes';
 
-export const AuthModal = ({ onClose }: AuthModalProps) => {
-  const [modalState, setModalState] = useState<ModalState>('login');
+export const AuthModal = ({ onClose, challenge }: AuthModalProps) => {
+  // Invite links (/?invite=CODE) let people outside the university register
+  const inviteCode = new URLSearchParams(window.location.search).get('invite') ?? '';
+  const [modalState, setModalState] = useState<ModalState>(
+    challenge ? (challenge.two_factor_setup_required ? 'two-factor-setup' : 'two-factor') :
+    inviteCode ? 'register' : 'login'
+  );
   const [email, setEmail] = useState('');
   const [password, setPassword] = useState('');
   const [name, setName] = useState('');
   const [verificationToken, setVerificationToken] = useState('');
   const [message, setMessage] = useState('');
   const [debugInfo, setDebugInfo] = useState<string>(''); 
+  // Second login step, when the password was right but 2FA is on or required
+  const [challengeToken, setChallengeToken] = useState('');
+  const [twoFactorCode, setTwoFactorCode] = useState('');
+  const [twoFactorSetup, setTwoFactorSetup] = useState<TwoFactorSetup | null>(null);
+  const [enrolledLogin, setEnrolledLogin] = useState<LoginResponse | null>(null);
+
+  const { login, verifyTwoFactor, completeLogin, register, verifyEmail, isLoading, error } = useAuth();
+
+  const startTwoFactor = async (challenge: TwoFactorChallenge) => {
+    setChallengeToken(challenge.challenge_token);
+    setTwoFactorCode('');
+    if (challenge.two_factor_setup_required) {
+      setTwoFactorSetup(await api.setupTwoFactorAtLogin(challenge.challenge_token));
+      setMessage('Your role requires two factor authentication. Add this account to your authenticator app to continue.');
+      setModalState('two-factor-setup');
+    } else {
+      setModalState('two-factor');
+    }
+  };
 
-  const { login, register, verifyEmail, isLoading, error } = useAuth();
+  useEffect(() => {
+    if (challenge) {
+      startTwoFactor(challenge).catch((err) => {
+        setMessage(err instanceof Error ? err.message : 'An unexpected error occurred');
+      });
+    }
+  }, [challenge]);
 
   const handleSubmit = async (e: React.FormEvent) => {
     e.preventDefault();
@@ -25,10 +59,17 @@ export const AuthModal = ({ onClose }: AuthModalProps) => {
     
     try {
       if (modalState === 'login') {
-        await login(email, password);
-        onClose();
+        const loginChallenge = await login(email, password);
+        if (!loginChallenge) {
+          onClose();
+          return;
+        }
+        await startTwoFactor(loginChallenge);
+      } else if (modalState === 'forgot') {
+        const response = await api.forgotPassword(email);
+        setMessage(response.message);
       } else if (modalState === 'register') {
-        const response = await register(email, password, name);
+        const response = await register(email, password, name, inviteCode || undefined);
         console.log('Registration response:', response);
         
         if (response && response.verify_token) {
@@ -48,6 +89,34 @@ export const AuthModal = ({ onClose }: AuthModalProps) => {
     }
   };
 
+  const handleTwoFactorSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setMessage('');
+
+    try {
+      if (modalState === 'two-factor') {
+        await verifyTwoFactor(challengeToken, twoFactorCode);
+        onClose();
+      } else {
+        // Logging in straight away would close the modal, so hold the
+        // session until the recovery codes have been saved
+        const data = await api.enableTwoFactorAtLogin(challengeToken, twoFactorCode);
+        setEnrolledLogin(data);
+        setMessage('');
+        setModalState('recovery-codes');
+      }
+    } catch (err) {
+      setMessage(err instanceof Error ? err.message : 'An unexpected error occurred');
+    }
+  };
+
+  const handleRecoveryCodesSaved = () => {
+    if (enrolledLogin) {
+      completeLogin(enrolledLogin);
+    }
+    onClose();
+  };
+
   const handleVerification = async () => {
     try {
       await verifyEmail(verificationToken);
@@ -66,6 +135,10 @@ export const AuthModal = ({ onClose }: AuthModalProps) => {
         <div className="flex justify-between items-center mb-4">
           <h2 className="text-2xl text-black font-bold">
             {modalState === 'verify' ? 'Verify Email' : 
+             modalState === 'forgot' ? 'Reset Password' :
+             modalState === 'two-factor' ? 'Two Factor Authentication' :
+             modalState === 'two-factor-setup' ? 'Set Up Two Factor Authentication' :
+             modalState === 'recovery-codes' ? 'Save Your Recovery Codes' :
              modalState === 'login' ? 'Login' : 'Register'}
           </h2>
           <button onClick={onClose} className="text-gray-500 hover:text-gray-700">
@@ -92,7 +165,79 @@ export const AuthModal = ({ onClose }: AuthModalProps) => {
           </div>
         )}
   
-        {modalState === 'verify' ? (
+        {modalState === 'recovery-codes' ? (
+          <div className="space-y-4">
+            <p className="text-sm text-gray-600">
+              Each of these codes can be used once to log in if you lose your authenticator app. They won't be shown again.
+            </p>
+            <div className="grid grid-cols-2 gap-2 p-4 bg-gray-50 rounded-lg">
+              {(enrolledLogin?.recovery_codes ?? []).map((code) => (
+                <code key={code} className="text-black text-sm">{code}</code>
+              ))}
+            </div>
+            <button
+              onClick={handleRecoveryCodesSaved}
+              className="w-full flex items-center justify-center gap-2 bg-blue-500 text-white p-2 rounded hover:bg-blue-600"
+            >
+              <Check className="w-5 h-5" />
+              I've saved these codes
+            </button>
+          </div>
+        ) : modalState === 'two-factor' || modalState === 'two-factor-setup' ? (
+          <form onSubmit={handleTwoFactorSubmit} className="space-y-4">
+            {modalState === 'two-factor-setup' && twoFactorSetup && (
+              <div className="p-4 bg-gray-50 rounded-lg">
+                <p className="text-sm text-gray-600 mb-2">
+                  Open <a href={twoFactorSetup.otpauth_uri} className="text-blue-500 hover:text-blue-700">this link</a> on
+                  your phone, or enter this key in your authenticator app:
+                </p>
+                <code className="block p-2 bg-gray-100 text-black rounded text-sm break-all">
+                  {twoFactorSetup.secret}
+                </code>
+              </div>
+            )}
+
+            <div>
+              <label className="block text-sm font-medium text-gray-700">
+                {modalState === 'two-factor'
+                  ? 'Code from your authenticator app, or a recovery code'
+                  : 'Code from your authenticator app'}
+              </label>
+              <input
+                type="text"
+                value={twoFactorCode}
+                onChange={(e) => setTwoFactorCode(e.target.value)}
+                className="mt-1 w-full p-2 border rounded text-black focus:ring-2 focus:ring-blue-500"
+                autoComplete="one-time-code"
+                autoFocus
+                required
+              />
+            </div>
+
+            <button
+              type="submit"
+              disabled={isLoading}
+              className="w-full flex items-center justify-center gap-2 bg-blue-500 text-white p-2 rounded hover:bg-blue-600 disabled:opacity-50"
+            >
+              {isLoading ? (
+                'Verifying...'
+              ) : (
+                <>
+                  <ShieldCheck className="w-5 h-5" />
+                  {modalState === 'two-factor' ? 'Verify' : 'Enable and Log In'}
+                </>
+              )}
+            </button>
+
+            <button
+              type="button"
+              onClick={() => setModalState('login')}
+              className="w-full text-blue-500 hover:text-blue-700"
+            >
+              Back to Login
+            </button>
+          </form>
+        ) : modalState === 'verify' ? (
           <div className="space-y-4">
             {verificationToken ? (
               <div className="p-4 bg-gray-50 rounded-lg">
@@ -134,7 +279,7 @@ export const AuthModal = ({ onClose }: AuthModalProps) => {
           <form onSubmit={handleSubmit} className="space-y-4">
             <div>
               <label className="block text-sm font-medium text-gray-700">
-                Email (@student.gla.ac.uk)
+                {inviteCode && modalState === 'register' ? 'Email' : 'Email (@student.gla.ac.uk)'}
               </label>
               <input
                 type="email"
@@ -142,7 +287,7 @@ export const AuthModal = ({ onClose }: AuthModalProps) => {
                 onChange={(e) => setEmail(e.target.value)}
                 className="mt-1 w-full p-2 border rounded focus:ring-2 focus:ring-blue-500"
                 required
-                pattern=".*@student\.gla\.ac\.uk$"
+                pattern={(inviteCode && modalState === 'register') || modalState === 'forgot' ? undefined : '.*@student\\.gla\\.ac\\.uk$'}
                 title="Please use your Glasgow University email address"
               />
             </div>
@@ -162,6 +307,7 @@ export const AuthModal = ({ onClose }: AuthModalProps) => {
               </div>
             )}
   
+            {modalState !== 'forgot' && (
             <div>
               <label className="block text-sm font-medium text-gray-700">
                 Password
@@ -175,6 +321,7 @@ export const AuthModal = ({ onClose }: AuthModalProps) => {
                 minLength={8}
               />
             </div>
+            )}
   
             <button
               type="submit"
@@ -183,6 +330,11 @@ export const AuthModal = ({ onClose }: AuthModalProps) => {
             >
               {isLoading ? (
                 'Loading...'
+              ) : modalState === 'forgot' ? (
+                <>
+                  <Mail className="w-5 h-5" />
+                  Send Reset Link
+                </>
               ) : modalState === 'login' ? (
                 <>
                   <Mail className="w-5 h-5" />
@@ -196,6 +348,27 @@ export const AuthModal = ({ onClose }: AuthModalProps) => {
               )}
             </button>
   
+            {modalState === 'login' && import.meta.env.VITE_OIDC_ENABLED === 'true' && (
+              <a
+                href={api.oidcLoginUrl}
+                className="w-full block text-center bg-gray-200 text-gray-700 p-2 rounded hover:bg-gray-300"
+              >
+                Log in with your university account
+              </a>
+            )}
+
+            {modalState === 'login' && (
+              <div className="text-center">
+                <button
+                  type="button"
+                  onClick={() => setModalState('forgot')}
+                  className="text-sm text-gray-500 hover:text-gray-700"
+                >
+                  Forgot your password?
+                </button>
+              </div>
+            )}
+
             {modalState !== 'verify' && (
               <div className="text-center">
                 <button
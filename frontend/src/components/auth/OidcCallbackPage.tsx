@@ -0,0 +1,66 @@
+import { useEffect, useState } from 'react';
+import { Link, useNavigate } from 'react-router-dom';
+import { useAuth } from '../../context/AuthContext';
+import { api } from '../../services/api';
+import type { TwoFactorChallenge } from '../../services/api';
+import { AuthModal } from './AuthModal';
+
+// The server redirects here after single sign-on with the result in the URL
+// fragment: a session, a two factor challenge, or an error
+export const OidcCallbackPage = () => {
+  const navigate = useNavigate();
+  const { completeLogin } = useAuth();
+  // Read once, the fragment is cleared straight away so tokens don't linger in history
+  const [params] = useState(() => new URLSearchParams(window.location.hash.slice(1)));
+  const [challenge] = useState<TwoFactorChallenge | null>(() =>
+    params.get('challenge_token') ? {
+      challenge_token: params.get('challenge_token')!,
+      two_factor_required: params.get('two_factor_required') === 'true',
+      two_factor_setup_required: params.get('two_factor_setup_required') === 'true',
+    } : null
+  );
+  const [error, setError] = useState<string | null>(params.get('error'));
+
+  useEffect(() => {
+    window.history.replaceState(null, '', window.location.pathname);
+
+    if (error || challenge) {
+      return;
+    }
+    if (!params.get('token') && !params.get('csrf_token')) {
+      setError('Invalid login response');
+      return;
+    }
+
+    api.completeOIDCLogin(params)
+      .then((data) => {
+        completeLogin(data);
+        navigate('/', { replace: true });
+      })
+      .catch((err) => {
+        setError(err instanceof Error ? err.message : 'Failed to complete login');
+      });
+  }, []);
+
+  if (challenge && !error) {
+    return <AuthModal challenge={challenge} onClose={() => navigate('/', { replace: true })} />;
+  }
+
+  return (
+    <div className="flex flex-col items-center justify-center min-h-screen bg-gray-100 p-4 w-full">
+      <div className="bg-white rounded-lg shadow-lg p-8 max-w-md w-full text-center">
+        {error ? (
+          <>
+            <h1 className="text-2xl font-bold text-gray-800 mb-4">Login failed</h1>
+            <p className="text-gray-600 mb-6">{error}</p>
+            <Link to="/" className="text-blue-500 hover:text-blue-700">
+              Back to the forum
+            </Link>
+          </>
+        ) : (
+          <p className="text-gray-600">Logging you in...</p>
+        )}
+      </div>
+    </div>
+  );
+};
@@ -0,0 +1,112 @@
+import React, { useState } from 'react';
+import { Link, useSearchParams } from 'react-router-dom';
+import { KeyRound } from 'lucide-react';
+import { api } from '../../services/api';
+
+// Opened from the link in a password reset email (/reset-password?token=...)
+export const ResetPasswordPage = () => {
+  const [searchParams] = useSearchParams();
+  const token = searchParams.get('token') ?? '';
+  const [password, setPassword] = useState('');
+  const [confirmPassword, setConfirmPassword] = useState('');
+  const [isLoading, setIsLoading] = useState(false);
+  const [error, setError] = useState<string | null>(null);
+  const [done, setDone] = useState(false);
+
+  const handleSubmit = async (e: React.FormEvent) => {
+    e.preventDefault();
+    setError(null);
+
+    if (password !== confirmPassword) {
+      setError('Passwords do not match');
+      return;
+    }
+
+    try {
+      setIsLoading(true);
+      await api.resetPassword(token, password);
+      setDone(true);
+    } catch (err) {
+      setError(err instanceof Error ? err.message : 'Failed to reset password');
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  return (
+    <div className="flex flex-col items-center justify-center min-h-screen bg-gray-100 p-4 w-full">
+      <div className="bg-white rounded-lg shadow-lg p-8 max-w-md w-full">
+        <div className="flex justify-center mb-6">
+          <div className="bg-blue-100 p-3 rounded-full">
+            <KeyRound className="w-8 h-8 text-blue-500" />
+          </div>
+        </div>
+
+        <h1 className="text-2xl font-bold text-center text-gray-800 mb-6">
+          Reset your password
+        </h1>
+
+        {!token ? (
+          <p className="text-gray-600 text-center">
+            This reset link is incomplete. Please open the link from your email again.
+          </p>
+        ) : done ? (
+          <div className="space-y-4 text-center">
+            <p className="text-gray-600">
+              Your password has been changed and you have been logged out everywhere. You can now log in with your new password.
+            </p>
+            <Link to="/" className="text-blue-500 hover:text-blue-700">
+              Back to the forum
+            </Link>
+          </div>
+        ) : (
+          <form onSubmit={handleSubmit} className="space-y-4">
+            {error && (
+              <div className="p-3 bg-red-100 border border-red-400 text-red-700 rounded">
+                {error}
+              </div>
+            )}
+
+            <div>
+              <label className="block text-sm font-medium text-gray-700">
+                New password
+              </label>
+              <input
+                type="password"
+                value={password}
+                onChange={(e) => setPassword(e.target.value)}
+                className="mt-1 w-full p-2 border rounded text-black focus:ring-2 focus:ring-blue-500"
+                required
+                minLength={8}
+                autoComplete="new-password"
+              />
+            </div>
+
+            <div>
+              <label className="block text-sm font-medium text-gray-700">
+                Confirm new password
+              </label>
+              <input
+                type="password"
+                value={confirmPassword}
+                onChange={(e) => setConfirmPassword(e.target.value)}
+                className="mt-1 w-full p-2 border rounded text-black focus:ring-2 focus:ring-blue-500"
+                required
+                minLength={8}
+                autoComplete="new-password"
+              />
+            </div>
+
+            <button
+              type="submit"
+              disabled={isLoading}
+              className="w-full bg-blue-500 text-white p-2 rounded hover:bg-blue-600 disabled:opacity-50"
+            >
+              {isLoading ? 'Saving...' : 'Set new password'}
+            </button>
+          </form>
+        )}
+      </div>
+    </div>
+  );
+};
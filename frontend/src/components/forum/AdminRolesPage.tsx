@@ -12,7 +12,10 @@ type User = {
   ID: number;
   name: string;
   email: string;
+  role_id: number;
   role: Role;
+  thread_count: number;
+  reply_count: number;
 };
 
 export const AdminRolesPage = () => {
@@ -20,26 +23,46 @@ export const AdminRolesPage = () => {
   const [users, setUsers] = useState<User[]>([]);
   const [loading, setLoading] = useState(true);
   const [error, setError] = useState<string | null>(null);
+  const [search, setSearch] = useState('');
+  const [nextCursor, setNextCursor] = useState('');
 
   useEffect(() => {
-    const fetchData = async () => {
+    api.getRoles()
+      .then(setRoles)
+      .catch((error) => {
+        setError('Failed to fetch roles');
+        console.error('Error:', error);
+      });
+  }, []);
+
+  // Refetch from the first page whenever the search changes
+  useEffect(() => {
+    const timeout = setTimeout(async () => {
       try {
-        const [rolesData, usersData] = await Promise.all([
-          api.getRoles(),
-          api.getUsers()
-        ]);
-        setRoles(rolesData);
+        const usersData = await api.getUsers({ q: search, sort: 'name' });
         setUsers(usersData.users);
+        setNextCursor(usersData.pagination.next_cursor);
       } catch (error) {
-        setError('Failed to fetch data');
+        setError('Failed to fetch users');
         console.error('Error:', error);
       } finally {
         setLoading(false);
       }
-    };
+    }, 300);
 
-    fetchData();
-  }, []);
+    return () => clearTimeout(timeout);
+  }, [search]);
+
+  const loadMore = async () => {
+    try {
+      const usersData = await api.getUsers({ q: search, sort: 'name', cursor: nextCursor });
+      setUsers([...users, ...usersData.users]);
+      setNextCursor(usersData.pagination.next_cursor);
+    } catch (error) {
+      setError('Failed to fetch users');
+      console.error('Error:', error);
+    }
+  };
 
   const handleRoleChange = async (userId: number, roleId: number) => {
     try {
@@ -111,12 +134,21 @@ export const AdminRolesPage = () => {
       </div>
 
       {/* User Management Table */}
+      <input
+        type="search"
+        className="w-full mb-4 px-3 py-2 border rounded text-black"
+        placeholder="Search by name or email"
+        value={search}
+        onChange={(e) => setSearch(e.target.value)}
+      />
       <div className="bg-white text-black rounded-lg shadow overflow-hidden">
         <table className="w-full">
           <thead className="bg-gray-50">
             <tr>
               <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase">User</th>
               <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase">Email</th>
+              <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase">Threads</th>
+              <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase">Replies</th>
               <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase">Current Role</th>
               <th className="px-6 py-3 text-left text-xs font-medium text-gray-500 uppercase">Actions</th>
             </tr>
@@ -126,6 +158,8 @@ export const AdminRolesPage = () => {
               <tr key={user.ID}>
                 <td className="px-6 py-4">{user.name}</td>
                 <td className="px-6 py-4">{user.email}</td>
+                <td className="px-6 py-4">{user.thread_count}</td>
+                <td className="px-6 py-4">{user.reply_count}</td>
                 <td className="px-6 py-4">
                 {user.role ? (
                     <span
@@ -165,6 +199,14 @@ export const AdminRolesPage = () => {
           </tbody>
         </table>
       </div>
+      {nextCursor && (
+        <button
+          className="mt-4 px-4 py-2 rounded bg-gray-200 text-black"
+          onClick={loadMore}
+        >
+          Load more
+        </button>
+      )}
     </div>
   );
 };
@@ -1,8 +1,9 @@
-import React, { useState } from 'react';
+import React, { useEffect, useState } from 'react';
 import { MessageCircle, Users, PlaneTakeoff, Wrench, Code, UserCircle, Shield } from 'lucide-react';
 import { useAuth } from '../../context/AuthContext';
 import { AuthModal } from '../auth/AuthModal';
 import { useNavigate } from 'react-router-dom';
+import { api } from '../../services/api';
 
 type SidebarProps = {
   currentSection: string;
@@ -13,15 +14,27 @@ export const Sidebar = ({ currentSection, onSectionChange }: SidebarProps) => {
   const { user, logout } = useAuth();
   const [showAuthModal, setShowAuthModal] = useState(false);
   const [showUserMenu, setShowUserMenu] = useState(false);
+  const [hiddenSections, setHiddenSections] = useState<string[]>([]);
   const navigate = useNavigate();
 
+  // Sections with rules that don't include the user are left out
+  useEffect(() => {
+    if (!user) {
+      setHiddenSections([]);
+      return;
+    }
+    api.getSectionAccess()
+      .then((access) => setHiddenSections(access.hidden ?? []))
+      .catch((err) => console.error('Failed to load section access:', err));
+  }, [user]);
+
   const sections = [
     { id: 'general', name: 'General Discussion', icon: MessageCircle },
     { id: 'team', name: 'Team Management', icon: Users },
     { id: 'design', name: 'Design Team', icon: PlaneTakeoff },
     { id: 'electronics', name: 'Electronics', icon: Wrench },
     { id: 'software', name: 'Software Development', icon: Code }
-  ];
+  ].filter((section) => !hiddenSections.includes(section.id));
 
   const handleSectionChange = (section: string) => {
     onSectionChange(section);
@@ -1,6 +1,7 @@
 // AuthContext.tsx
 import React, { createContext, useContext, useState, useEffect } from 'react';
 import { api } from '../services/api';
+import type { LoginResponse, TwoFactorChallenge } from '../services/api';
 
 type User = {
   id: number;
@@ -17,8 +18,11 @@ type RegisterResponse = {
 type AuthContextType = {
   user: User | null;
   token: string | null;
-  login: (email: string, password: string) => Promise<void>;
-  register: (email: string, password: string, name: string) => Promise<RegisterResponse>;
+  // Resolves to a challenge when a second factor is needed, null once logged in
+  login: (email: string, password: string) => Promise<TwoFactorChallenge | null>;
+  verifyTwoFactor: (challengeToken: string, code: string) => Promise<void>;
+  completeLogin: (data: LoginResponse) => void;
+  register: (email: string, password: string, name: string, inviteCode?: string) => Promise<RegisterResponse>;
   verifyEmail: (token: string) => Promise<void>;
   isLoading: boolean;
   error: string | null;
@@ -40,15 +44,23 @@ export const AuthProvider = ({ children }: { children: React.ReactNode }) => {
     }
   }, []);
 
+  // The session itself was already stored by the api call
+  const completeLogin = (data: LoginResponse) => {
+    setToken(data.token);
+    setUser(data.user);
+    localStorage.setItem('user', JSON.stringify(data.user));
+  };
+
   const login = async (email: string, password: string) => {
     try {
       setIsLoading(true);
       setError(null);
       const data = await api.login(email, password);
-      setToken(data.token);
-      setUser(data.user);
-      localStorage.setItem('token', data.token);
-      localStorage.setItem('user', JSON.stringify(data.user));
+      if ('challenge_token' in data) {
+        return data;
+      }
+      completeLogin(data);
+      return null;
     } catch (err) {
       setError(err instanceof Error ? err.message : 'Failed to login');
       throw err;
@@ -57,11 +69,24 @@ export const AuthProvider = ({ children }: { children: React.ReactNode }) => {
     }
   };
 
-  const register = async (email: string, password: string, name: string) => {
+  const verifyTwoFactor = async (challengeToken: string, code: string) => {
+    try {
+      setIsLoading(true);
+      setError(null);
+      completeLogin(await api.verifyTwoFactor(challengeToken, code));
+    } catch (err) {
+      setError(err instanceof Error ? err.message : 'Failed to verify code');
+      throw err;
+    } finally {
+      setIsLoading(false);
+    }
+  };
+
+  const register = async (email: string, password: string, name: string, inviteCode?: string) => {
     try {
       setIsLoading(true);
       setError(null);
-      const response = await api.register(email, password, name);
+      const response = await api.register(email, password, name, inviteCode);
       return response; // Return the full response object
     } catch (err) {
       setError(err instanceof Error ? err.message : 'Failed to register');
@@ -85,6 +110,7 @@ export const AuthProvider = ({ children }: { children: React.ReactNode }) => {
   };
 
   const logout = () => {
+    api.logout();
     setUser(null);
     setToken(null);
     localStorage.removeItem('token');
@@ -96,6 +122,8 @@ export const AuthProvider = ({ children }: { children: React.ReactNode }) => {
       user, 
       token, 
       login, 
+      verifyTwoFactor,
+      completeLogin,
       register, 
       verifyEmail,
       logout, 
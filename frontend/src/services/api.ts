@@ -1,7 +1,10 @@
 const API_URL = 'http://localhost:8080/api';
 
-type LoginResponse = {
+export type LoginResponse = {
   token: string;
+  refresh_token?: string; // Not sent in cookie mode
+  csrf_token?: string; // Only sent in cookie mode
+  expires_in: number;
   user: {
     id: number;
     email: string;
@@ -9,6 +12,53 @@ type LoginResponse = {
     role: string;
     verified: boolean;
   };
+  recovery_codes?: string[]; // Only when 2FA was just set up
+};
+
+// Returned by login instead of a session when a second factor is needed.
+// two_factor_setup_required means the user's role requires 2FA and they
+// have to enrol before they can log in.
+export type TwoFactorChallenge = {
+  challenge_token: string;
+  two_factor_required: boolean;
+  two_factor_setup_required: boolean;
+};
+
+export type TwoFactorSetup = {
+  secret: string;
+  otpauth_uri: string;
+};
+
+export type SectionGrant = {
+  can_read: boolean;
+  can_post: boolean;
+  can_moderate: boolean;
+};
+
+export type SectionAccess = {
+  restricted: Record<string, SectionGrant>;
+  hidden: string[] | null; // null when nothing is hidden
+};
+
+type UserDirectoryParams = {
+  q?: string; // name or email contains
+  role_id?: number;
+  verified?: boolean;
+  joined_from?: string; // YYYY-MM-DD
+  joined_to?: string;
+  active_from?: string;
+  active_to?: string;
+  sort?: 'name' | 'email' | 'joined' | 'last_active' | 'threads' | 'replies';
+  order?: 'asc' | 'desc';
+  limit?: number;
+  cursor?: string;
+};
+
+type RoleInput = {
+  name: string;
+  color: string; // #RRGGBB
+  permissions?: Record<string, boolean>; // keys from getPermissionCatalogue
+  require_two_factor?: boolean;
 };
 
 type RegisterResponse = {
@@ -56,25 +106,112 @@ type PublicUserProfile = {
 };
 
 
+// Stored in place of the access token when the server keeps the session in
+// HttpOnly cookies (AUTH_COOKIES=true), so the rest of the app still sees a token
+const COOKIE_SESSION = 'cookie';
+
+// Headers authenticating a request: the bearer token, or in cookie mode the
+// CSRF token the server checks against its cookie
+const authHeaders = (token: string | null): Record<string, string> => {
+  if (token === COOKIE_SESSION) {
+    const csrfToken = localStorage.getItem('csrf_token');
+    return csrfToken ? { 'X-CSRF-Token': csrfToken } : {};
+  }
+  return token ? { 'Authorization': `Bearer ${token}` } : {};
+};
+
+// Remember the tokens from a login or refresh response
+const storeSession = (data: { token?: string; refresh_token?: string; csrf_token?: string }): string => {
+  if (data.csrf_token) {
+    localStorage.setItem('token', COOKIE_SESSION);
+    localStorage.setItem('csrf_token', data.csrf_token);
+    localStorage.removeItem('refresh_token');
+    return COOKIE_SESSION;
+  }
+  localStorage.setItem('token', data.token!);
+  localStorage.setItem('refresh_token', data.refresh_token!);
+  return data.token!;
+};
+
+const clearSession = () => {
+  localStorage.removeItem('token');
+  localStorage.removeItem('refresh_token');
+  localStorage.removeItem('csrf_token');
+};
+
+// Exchange the stored refresh token for a new access token, returns null if the session is gone
+const doRefreshSession = async (): Promise<string | null> => {
+  const token = localStorage.getItem('token');
+  const refreshToken = localStorage.getItem('refresh_token');
+  if (token !== COOKIE_SESSION && !refreshToken) {
+    return null;
+  }
+
+  // In cookie mode the refresh token is sent as a cookie
+  const response = await fetch(`${API_URL}/auth/refresh`, {
+    method: 'POST',
+    credentials: 'include',
+    headers: { 'Content-Type': 'application/json', ...authHeaders(token) },
+    body: token === COOKIE_SESSION ? undefined : JSON.stringify({ refresh_token: refreshToken }),
+  });
+
+  // Another tab refreshed with the same token a moment ago. Its new tokens
+  // are in localStorage (or the cookies) by now, so use those.
+  if (response.status === 409 && (token === COOKIE_SESSION || localStorage.getItem('refresh_token') !== refreshToken)) {
+    return localStorage.getItem('token');
+  }
+
+  if (!response.ok) {
+    clearSession();
+    return null;
+  }
+
+  return storeSession(await response.json());
+};
+
+// Requests that fail together after the access token expires share one
+// refresh. Sending the same refresh token twice looks like it was stolen and
+// gets the whole session revoked.
+let refreshInFlight: Promise<string | null> | null = null;
+
+const refreshSession = (): Promise<string | null> => {
+  if (!refreshInFlight) {
+    refreshInFlight = doRefreshSession().finally(() => {
+      refreshInFlight = null;
+    });
+  }
+  return refreshInFlight;
+};
+
 // Helper function for common fetch options
-const fetchApi = async (endpoint: string, options?: RequestInit) => {
+// Password policy errors list every broken rule under reasons
+const errorMessage = (body: { error?: string; reasons?: { message: string }[] }) =>
+  body.reasons?.length ? body.reasons.map((r) => r.message).join('. ') : body.error;
+
+const fetchApi = async (endpoint: string, options?: RequestInit, retry = true): Promise<any> => {
   // Retrieve the token from local storage or wherever you store it
   const token = localStorage.getItem('token'); // Adjust this based on your storage method
 
   const response = await fetch(`${API_URL}${endpoint}`, {
     ...options,
+    credentials: 'include',
     headers: {
       'Content-Type': 'application/json',
       ...options?.headers,
-      ...(token ? { 'Authorization': `Bearer ${token}` } : {}), // Include token if it exists
+      ...authHeaders(token), // Include token if it exists
     },
   });
 
+  // Access tokens are short lived, refresh once and retry
+  if (response.status === 401 && retry && token && await refreshSession()) {
+    return fetchApi(endpoint, options, false);
+  }
+
   const responseBody = await response.json();
   console.log('Response Body:', responseBody); // Log the response body
 
   if (!response.ok) {
-    throw new Error(`API Error: ${responseBody.error}`);
+    throw new Error(`API Error: ${errorMessage(responseBody)}`);
   }
 
   return responseBody;
@@ -92,8 +229,39 @@ export const api = {
   getRoles: () => 
     fetchApi('/roles'),
 
-  getUsers: () => 
-    fetchApi('/users'),
+  getPermissionCatalogue: () =>
+    fetchApi('/roles/permissions'),
+
+  createRole: (role: RoleInput) =>
+    fetchApi('/roles', {
+      method: 'POST',
+      body: JSON.stringify(role),
+    }),
+
+  updateRole: (roleId: number, role: Partial<RoleInput>) =>
+    fetchApi(`/roles/${roleId}`, {
+      method: 'PUT',
+      body: JSON.stringify(role),
+    }),
+
+  // reassignTo moves the role's users to another role, required while it has any
+  deleteRole: (roleId: number, reassignTo?: number) =>
+    fetchApi(`/roles/${roleId}${reassignTo ? `?reassign_to=${reassignTo}` : ''}`, {
+      method: 'DELETE',
+    }),
+
+  // Admin user directory, pass the previous response's next_cursor to get
+  // the following page with the same filters
+  getUsers: (params: UserDirectoryParams = {}) => {
+    const query = new URLSearchParams();
+    Object.entries(params).forEach(([key, value]) => {
+      if (value !== undefined && value !== '') {
+        query.set(key, String(value));
+      }
+    });
+    const search = query.toString();
+    return fetchApi(`/users${search ? `?${search}` : ''}`);
+  },
 
   getCurrentUserProfile: () => 
     fetchApi('/profile'),
@@ -137,6 +305,12 @@ export const api = {
       body: JSON.stringify(threadData),
     }),
 
+  // Delete a thread, your own or one in a section you moderate
+  deleteThread: (threadId: number) =>
+    fetchApi(`/threads/${threadId}`, {
+      method: 'DELETE',
+    }),
+
   // Get replies for a thread
   getReplies: (threadId: number) => 
     fetchApi(`/threads/${threadId}/replies`),
@@ -148,20 +322,111 @@ export const api = {
       body: JSON.stringify({ content }),
     }),
 
-  login: async (email: string, password: string): Promise<LoginResponse> => {
+  // Delete a reply, your own or one in a section you moderate
+  deleteReply: (threadId: number, replyId: number) =>
+    fetchApi(`/threads/${threadId}/replies/${replyId}`, {
+      method: 'DELETE',
+    }),
+
+  // Sections with rules and what the current user may do in each, plus the
+  // ones they can't see at all
+  getSectionAccess: (): Promise<SectionAccess> =>
+    fetchApi('/sections/access'),
+
+  login: async (email: string, password: string): Promise<LoginResponse | TwoFactorChallenge> => {
     const response = await fetchApi('/auth/login', {
       method: 'POST',
       body: JSON.stringify({ email, password }),
     });
 
-    if (response.token) {
-      localStorage.setItem('token', response.token);
+    if (response.token || response.csrf_token) {
+      response.token = storeSession(response);
     }
     console.log(response);
     return response;
   },
 
-  register: async (email: string, password: string, name: string) => {
+  // Single sign-on starts with a full page redirect to the identity provider
+  oidcLoginUrl: `${API_URL}/auth/oidc/login`,
+
+  // The SSO callback passes the session in the URL fragment, without the user
+  completeOIDCLogin: async (params: URLSearchParams): Promise<LoginResponse> => {
+    const token = storeSession({
+      token: params.get('token') ?? undefined,
+      refresh_token: params.get('refresh_token') ?? undefined,
+      csrf_token: params.get('csrf_token') ?? undefined,
+    });
+    const profile = await fetchApi('/profile');
+    return {
+      token,
+      expires_in: 0,
+      user: {
+        id: profile.id,
+        email: profile.email,
+        name: profile.name,
+        role: profile.role,
+        verified: profile.verified,
+      },
+    };
+  },
+
+  // Second login step with a code from the authenticator app or a recovery code
+  verifyTwoFactor: async (challengeToken: string, code: string): Promise<LoginResponse> => {
+    const response = await fetchApi('/auth/2fa/verify', {
+      method: 'POST',
+      body: JSON.stringify({ challenge_token: challengeToken, code }),
+    });
+    response.token = storeSession(response);
+    return response;
+  },
+
+  // Enrolment during login for roles that require 2FA
+  setupTwoFactorAtLogin: (challengeToken: string): Promise<TwoFactorSetup> =>
+    fetchApi('/auth/2fa/setup', {
+      method: 'POST',
+      body: JSON.stringify({ challenge_token: challengeToken }),
+    }),
+
+  enableTwoFactorAtLogin: async (challengeToken: string, code: string): Promise<LoginResponse> => {
+    const response = await fetchApi('/auth/2fa/enable', {
+      method: 'POST',
+      body: JSON.stringify({ challenge_token: challengeToken, code }),
+    });
+    response.token = storeSession(response);
+    return response;
+  },
+
+  logout: async () => {
+    try {
+      await fetchApi('/auth/logout', { method: 'POST' });
+    } catch (error) {
+      console.error('Error logging out:', error);
+    } finally {
+      clearSession();
+    }
+  },
+
+  // Always succeeds so it can't reveal who has an account
+  forgotPassword: (email: string) =>
+    fetchApi('/auth/forgot-password', {
+      method: 'POST',
+      body: JSON.stringify({ email }),
+    }),
+
+  // token comes from the link in the reset email
+  resetPassword: (token: string, password: string) =>
+    fetchApi('/auth/reset-password', {
+      method: 'POST',
+      body: JSON.stringify({ token, password }),
+    }),
+
+  getSessions: () =>
+    fetchApi('/profile/sessions'),
+
+  revokeSession: (sessionId: number) =>
+    fetchApi(`/profile/sessions/${sessionId}`, { method: 'DELETE' }),
+
+  register: async (email: string, password: string, name: string, inviteCode?: string) => {
     try {
       console.log('Sending registration request:', { email, name });
       
@@ -170,14 +435,14 @@ export const api = {
         headers: {
           'Content-Type': 'application/json',
         },
-        body: JSON.stringify({ email, password, name }),
+        body: JSON.stringify({ email, password, name, invite_code: inviteCode }),
       });
 
       const data = await response.json();
       console.log('Raw backend response:', data);
 
       if (!response.ok) {
-        throw new Error(data.error || `API Error: ${response.statusText}`);
+        throw new Error(errorMessage(data) || `API Error: ${response.statusText}`);
       }
 
       // Check if we actually got a verification token
@@ -219,14 +484,16 @@ export const api = {
       try {
         const response = await fetch(`${API_URL}/auth/validate`, {
           method: 'POST',
+          credentials: 'include',
           headers: {
             'Content-Type': 'application/json',
-            'Authorization': `Bearer ${token}`,
+            ...authHeaders(token),
           },
         });
 
         if (!response.ok) {
-          return false; 
+          // The access token may just have expired
+          return (await refreshSession()) !== null;
         }
 
         return true; 